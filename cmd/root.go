@@ -17,6 +17,7 @@ package cmd
 
 import (
 	"github.com/paulfarver/valet/internal/github"
+	"github.com/paulfarver/valet/internal/image"
 	"github.com/paulfarver/valet/internal/rest"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -29,6 +30,7 @@ type Config struct {
 	Log    LogConfig     `mapstructure:"log"`
 	Rest   rest.Config   `mapstructure:"rest"`
 	Github github.Config `mapstructure:"github"`
+	Image  image.Config  `mapstructure:"image"`
 }
 
 type LogConfig struct {
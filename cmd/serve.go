@@ -20,6 +20,7 @@ import (
 
 	"github.com/paulfarver/valet/internal/chart"
 	"github.com/paulfarver/valet/internal/github"
+	"github.com/paulfarver/valet/internal/image"
 	"github.com/paulfarver/valet/internal/rest"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -58,12 +59,14 @@ func serve(cmd *cobra.Command, args []string) {
 			logger,
 			conf.Rest,
 			conf.Github,
+			conf.Image,
 		),
 
 		fx.Provide(
 			rest.NewServer,
 			github.NewService,
 			chart.NewServiceMock,
+			image.NewService,
 		),
 
 		fx.Invoke(serverLifecycle),
@@ -0,0 +1,299 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v42/github"
+	"github.com/paulfarver/valet/internal/updater"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Merge methods of pull requests
+const (
+	MergeMethodMerge  = "merge"
+	MergeMethodSquash = "squash"
+	MergeMethodRebase = "rebase"
+)
+
+// automergeMarker is appended to the body of pull requests that valet merges
+// itself once their checks pass, for repositories without native auto-merge
+var automergeMarker = regexp.MustCompile(`<!-- valet:automerge (\w+) -->`)
+
+// AutomergeConfig merges the pull requests of a rule once their checks pass,
+// if every change is of one of the update types. No update types allows all.
+//
+//	automerge:
+//	  updateTypes: [patch, digest]
+//	  method: squash
+type AutomergeConfig struct {
+	UpdateTypes []string `yaml:"updateTypes"`
+	Method      string   `yaml:"method"`
+}
+
+func (c *AutomergeConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for _, t := range c.UpdateTypes {
+		switch t {
+		case updater.UpdateMajor, updater.UpdateMinor, updater.UpdatePatch, updater.UpdateDigest:
+		default:
+			return errors.Errorf("Unknown automerge update type %s", t)
+		}
+	}
+	switch c.Method {
+	case "", MergeMethodMerge, MergeMethodSquash, MergeMethodRebase:
+	default:
+		return errors.Errorf("Unknown merge method %s", c.Method)
+	}
+	return nil
+}
+
+func (c *AutomergeConfig) allows(change FileChange) bool {
+	return len(c.UpdateTypes) == 0 || contains(c.UpdateTypes, updater.UpdateType(change.Change))
+}
+
+func (c *AutomergeConfig) method() string {
+	if c.Method == "" {
+		return MergeMethodMerge
+	}
+	return c.Method
+}
+
+// Automerge returns the merge method of the pull request if it may be merged
+// automatically, which requires every rule contributing changes to allow
+// their update types. The method of the first rule is used.
+func (pr *PullRequest) Automerge() (string, bool) {
+	method := ""
+	for _, part := range pr.parts {
+		conf := part.scan.Rule.Automerge
+		if conf == nil {
+			return "", false
+		}
+		for _, change := range part.changes {
+			if !conf.allows(change) {
+				return "", false
+			}
+		}
+		if method == "" {
+			method = conf.method()
+		}
+	}
+	return method, method != ""
+}
+
+// enableAutomerge turns on native auto-merge of the pull request. If the
+// repository does not support it, the pull request is marked for valet to
+// merge it once its checks pass. Checks that already passed send no further
+// events, so the pull request is also merged right away if they did.
+func (r *Releaser) enableAutomerge(ctx context.Context, pr *github.PullRequest, method, body string) {
+	log := r.log.WithField("pull_request", pr.GetNumber())
+
+	err := r.graphql(ctx, `mutation($id: ID!, $method: PullRequestMergeMethod!) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: $method}) { clientMutationId }
+}`, map[string]interface{}{
+		"id":     pr.GetNodeID(),
+		"method": strings.ToUpper(method),
+	})
+	if err == nil {
+		log.Info("Enabled auto-merge")
+		return
+	}
+	log.WithError(err).Info("Failed to enable auto-merge, merging once checks pass")
+
+	owner := r.Repository.GetOwner().GetLogin()
+	if !automergeMarker.MatchString(body) {
+		_, _, err = r.Client.PullRequests.Edit(ctx, owner, r.Repository.GetName(), pr.GetNumber(), &github.PullRequest{
+			Body: github.String(fmt.Sprintf("%s\n\n<!-- valet:automerge %s -->\n", strings.TrimRight(body, "\n"), method)),
+		})
+		if err != nil {
+			log.WithError(err).Warn("Failed to mark pull request for merging")
+			return
+		}
+	}
+
+	if err := mergeIfChecked(ctx, r.Client, owner, r.Repository.GetName(), pr.GetHead().GetSHA(), pr.GetNumber(), method, log); err != nil {
+		log.WithError(err).Warn("Failed to check pull request for merging")
+	}
+}
+
+// disableAutomerge turns off native auto-merge of the pull request, when an
+// update brought in changes that may not be merged automatically
+func (r *Releaser) disableAutomerge(ctx context.Context, pr *github.PullRequest) {
+	if pr.AutoMerge == nil {
+		return
+	}
+	log := r.log.WithField("pull_request", pr.GetNumber())
+
+	err := r.graphql(ctx, `mutation($id: ID!) {
+  disablePullRequestAutoMerge(input: {pullRequestId: $id}) { clientMutationId }
+}`, map[string]interface{}{
+		"id": pr.GetNodeID(),
+	})
+	if err != nil {
+		log.WithError(err).Warn("Failed to disable auto-merge")
+		return
+	}
+	log.Info("Disabled auto-merge")
+}
+
+// withoutAutomerge returns the body without the automerge marker of the
+// merge method appended by enableAutomerge
+func withoutAutomerge(body, method string) string {
+	return strings.Replace(body, fmt.Sprintf("\n\n<!-- valet:automerge %s -->", method), "", 1)
+}
+
+// graphql runs the query against the GraphQL API of the GitHub instance
+func (r *Releaser) graphql(ctx context.Context, query string, variables map[string]interface{}) error {
+	u := *r.Client.BaseURL
+	if strings.HasSuffix(u.Path, "/api/v3/") {
+		// GitHub Enterprise Server serves GraphQL next to the REST API
+		u.Path = strings.TrimSuffix(u.Path, "v3/") + "graphql"
+	} else {
+		u.Path += "graphql"
+	}
+
+	req, err := r.Client.NewRequest("POST", u.String(), map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+
+	var res struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := r.Client.Do(ctx, req, &res); err != nil {
+		return err
+	}
+	if len(res.Errors) > 0 {
+		return errors.New(res.Errors[0].Message)
+	}
+	return nil
+}
+
+// MergeChecked merges the pull requests marked for merging by valet whose
+// head is the commit, once every status and check run of it succeeded. It
+// is called for check_suite and status events. As anyone can write the
+// marker, only pull requests opened by the app from a branch of the
+// repository itself are merged.
+func (s *Service) MergeChecked(ctx context.Context, installation int64, repo *github.Repository, sha string, l logrus.FieldLogger) error {
+	client, err := s.installationClient(installation)
+	if err != nil {
+		return err
+	}
+	owner := repo.GetOwner().GetLogin()
+	log := l.WithField("repository", repo.GetFullName()).WithField("sha", sha)
+
+	prs, _, err := client.PullRequests.ListPullRequestsWithCommit(ctx, owner, repo.GetName(), sha, nil)
+	if err != nil {
+		return errors.Wrap(err, "Failed to list pull requests of commit")
+	}
+
+	bot := ""
+	for _, pr := range prs {
+		m := automergeMarker.FindStringSubmatch(pr.GetBody())
+		if pr.GetState() != "open" || pr.GetHead().GetSHA() != sha || m == nil {
+			continue
+		}
+		if _, ok := ParseMetadata(pr); !ok || pr.GetHead().GetRepo().GetID() != repo.GetID() {
+			continue
+		}
+		if bot == "" {
+			if bot, err = s.botLogin(ctx); err != nil {
+				return err
+			}
+		}
+		if pr.GetUser().GetLogin() != bot {
+			log.Warnf("Not merging pull request #%d of %s", pr.GetNumber(), pr.GetUser().GetLogin())
+			continue
+		}
+
+		if err := mergeIfChecked(ctx, client, owner, repo.GetName(), sha, pr.GetNumber(), m[1], log); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// botLogin returns the login of the bot user the app acts as
+func (s *Service) botLogin(ctx context.Context) (string, error) {
+	client, err := s.newClient(s.atr)
+	if err != nil {
+		return "", err
+	}
+	app, _, err := client.Apps.Get(ctx, "")
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get app")
+	}
+	return app.GetSlug() + "[bot]", nil
+}
+
+// mergeIfChecked merges the pull request if its head is still the commit
+// and every check of the commit passed
+func mergeIfChecked(ctx context.Context, client *github.Client, owner, repo, sha string, number int, method string, log logrus.FieldLogger) error {
+	ok, err := checksPassed(ctx, client, owner, repo, sha)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		log.Debugf("Checks of pull request #%d have not passed yet", number)
+		return nil
+	}
+
+	_, _, err = client.PullRequests.Merge(ctx, owner, repo, number, "", &github.PullRequestOptions{
+		SHA:         sha,
+		MergeMethod: method,
+	})
+	if err != nil {
+		log.WithError(err).Warnf("Failed to merge pull request #%d", number)
+		return nil
+	}
+	log.Infof("Merged pull request #%d", number)
+	return nil
+}
+
+// checksPassed reports whether every commit status and check run of the
+// commit has completed successfully, which includes the required checks. A
+// commit without any checks has not passed, as they may not have started.
+func checksPassed(ctx context.Context, client *github.Client, owner, repo, sha string) (bool, error) {
+	status, _, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, sha, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to get combined status")
+	}
+	// Commits without statuses report a pending state
+	if status.GetTotalCount() > 0 && status.GetState() != "success" {
+		return false, nil
+	}
+
+	checks := status.GetTotalCount()
+	opts := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		runs, res, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, opts)
+		if err != nil {
+			return false, errors.Wrap(err, "Failed to list check runs")
+		}
+		checks += len(runs.CheckRuns)
+		for _, run := range runs.CheckRuns {
+			if run.GetStatus() != "completed" {
+				return false, nil
+			}
+			switch run.GetConclusion() {
+			case "success", "neutral", "skipped":
+			default:
+				return false, nil
+			}
+		}
+		if res.NextPage == 0 {
+			return checks > 0, nil
+		}
+		opts.Page = res.NextPage
+	}
+}
@@ -0,0 +1,129 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/google/go-github/v42/github"
+	"github.com/paulfarver/valet/internal/updater"
+	"github.com/pkg/errors"
+)
+
+// Commit collects the files changed by the bumps of a pull request, so that
+// they land in a single commit and CI runs once. Modes holds the git file
+// mode of the files that already exist, so executables stay executable.
+type Commit struct {
+	Files   map[string][]byte
+	Modes   map[string]string
+	Changes []FileChange
+}
+
+// FileChange is a change to a file of the repository. Document and
+// Namespace are the metadata of the object the change applies to, if any.
+type FileChange struct {
+	File      string
+	Document  string
+	Namespace string
+	updater.Change
+}
+
+func NewCommit() *Commit {
+	return &Commit{
+		Files: map[string][]byte{},
+		Modes: map[string]string{},
+	}
+}
+
+// Paths returns the sorted paths of the changed files
+func (c *Commit) Paths() []string {
+	paths := make([]string, 0, len(c.Files))
+	for p := range c.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// pushCommit creates a single commit on top of base that writes all the
+// files of the commit, and points the branch at it. An existing branch is
+// reset to the new commit, as it only ever holds the bumps of a previous scan,
+// unless it already holds the same files.
+func (r *Releaser) pushCommit(ctx context.Context, branch string, base *github.Reference, c *Commit, message string) error {
+	owner := r.Repository.GetOwner().GetLogin()
+	repo := r.Repository.GetName()
+
+	parent, _, err := r.Client.Git.GetCommit(ctx, owner, repo, base.Object.GetSHA())
+	if err != nil {
+		return errors.Wrap(err, "Failed to get base commit")
+	}
+
+	paths := c.Paths()
+	entries := make([]*github.TreeEntry, 0, len(paths))
+	for _, p := range paths {
+		mode, ok := c.Modes[p]
+		if !ok {
+			mode = "100644"
+		}
+		entries = append(entries, &github.TreeEntry{
+			Path:    github.String(p),
+			Mode:    github.String(mode),
+			Type:    github.String("blob"),
+			Content: github.String(string(c.Files[p])),
+		})
+	}
+
+	tree, _, err := r.Client.Git.CreateTree(ctx, owner, repo, parent.GetTree().GetSHA(), entries)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create tree")
+	}
+
+	name := fmt.Sprintf("heads/%s", branch)
+	current, res, err := r.Client.Git.GetRef(ctx, owner, repo, name)
+	exists := true
+	if res != nil && res.StatusCode == http.StatusNotFound {
+		exists = false
+	} else if err != nil {
+		return errors.Wrap(err, "Failed to get ref")
+	}
+	if exists {
+		// Pushing the same files again would rerun the checks and dismiss
+		// the reviews of the pull request
+		head, _, err := r.Client.Git.GetCommit(ctx, owner, repo, current.Object.GetSHA())
+		if err != nil {
+			return errors.Wrap(err, "Failed to get head commit")
+		}
+		if head.GetTree().GetSHA() == tree.GetSHA() {
+			r.log.Debugf("Branch %s is up to date", branch)
+			return nil
+		}
+	}
+
+	commit, _, err := r.Client.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+		Message: github.String(message),
+		Tree:    tree,
+		Parents: []*github.Commit{{SHA: parent.SHA}},
+	})
+	if err != nil {
+		return errors.Wrap(err, "Failed to create commit")
+	}
+
+	ref := &github.Reference{
+		Ref: github.String(name),
+		Object: &github.GitObject{
+			SHA: commit.SHA,
+		},
+	}
+	if !exists {
+		if _, _, err := r.Client.Git.CreateRef(ctx, owner, repo, ref); err != nil {
+			return errors.Wrap(err, "Failed to create ref")
+		}
+		return nil
+	}
+	if _, _, err := r.Client.Git.UpdateRef(ctx, owner, repo, ref, true); err != nil {
+		return errors.Wrap(err, "Failed to update ref")
+	}
+
+	return nil
+}
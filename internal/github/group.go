@@ -0,0 +1,118 @@
+package github
+
+import (
+	"path"
+
+	"github.com/paulfarver/valet/internal/image"
+	"github.com/paulfarver/valet/internal/updater"
+	"github.com/pkg/errors"
+)
+
+// GroupConfig combines the updates matching it into a single pull request.
+// Every criterion that is set must match, and glob patterns follow path.Match.
+// Updates are put in the first group they match.
+//
+//	groups:
+//	  - name: monitoring
+//	    charts: ["prometheus*", "grafana"]
+//	  - name: ghcr
+//	    registries: [ghcr.io]
+//	    updateTypes: [patch, minor]
+//	  - name: staging
+//	    files: ["deploy/staging/*"]
+type GroupConfig struct {
+	Name        string   `yaml:"name"`
+	Charts      []string `yaml:"charts"`
+	Registries  []string `yaml:"registries"`
+	Files       []string `yaml:"files"`
+	UpdateTypes []string `yaml:"updateTypes"`
+}
+
+func (c GroupConfig) Validate() error {
+	if c.Name == "" {
+		return errors.New("Group must have a name")
+	}
+	for _, patterns := range [][]string{c.Charts, c.Registries, c.Files} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return errors.Wrapf(err, "Invalid pattern %s in group %s", pattern, c.Name)
+			}
+		}
+	}
+	for _, t := range c.UpdateTypes {
+		switch t {
+		case updater.UpdateMajor, updater.UpdateMinor, updater.UpdatePatch, updater.UpdateDigest:
+		default:
+			return errors.Errorf("Unknown update type %s in group %s", t, c.Name)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the change belongs to the group
+func (c GroupConfig) Matches(change FileChange) bool {
+	if len(c.Charts) > 0 && (change.Kind != updater.KindChart || !matchAny(c.Charts, change.Name)) {
+		return false
+	}
+	if len(c.Registries) > 0 && (change.Kind != updater.KindImage || !matchAny(c.Registries, registry(change.Name))) {
+		return false
+	}
+	if len(c.Files) > 0 && !matchAny(c.Files, change.File) {
+		return false
+	}
+	if len(c.UpdateTypes) > 0 && !contains(c.UpdateTypes, updater.UpdateType(change.Change)) {
+		return false
+	}
+	return true
+}
+
+func readGroups(configs []GroupConfig) ([]GroupConfig, error) {
+	names := map[string]bool{}
+	for _, c := range configs {
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+		if names[c.Name] {
+			return nil, errors.Errorf("Duplicate group %s", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return configs, nil
+}
+
+// findGroup returns the first group the change belongs to, or nil
+func findGroup(groups []GroupConfig, change FileChange) *GroupConfig {
+	for i := range groups {
+		if groups[i].Matches(change) {
+			return &groups[i]
+		}
+	}
+	return nil
+}
+
+// registry returns the registry of the image, where images without one are on Docker Hub
+func registry(name string) string {
+	ref, err := image.ParseReference(name)
+	if err != nil || ref.Registry == "" {
+		return "docker.io"
+	}
+	return ref.Registry
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
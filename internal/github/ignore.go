@@ -0,0 +1,159 @@
+package github
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-github/v42/github"
+	"github.com/pkg/errors"
+)
+
+// Ways of ignoring the bumps of pull requests closed without merging. By
+// default the exact version is skipped, while major skips every version of
+// the same major and none reopens the bump on the next scan.
+const (
+	IgnoreClosedVersion = "version"
+	IgnoreClosedMajor   = "major"
+	IgnoreClosedNone    = "none"
+)
+
+// unignoreCommand in a comment of a closed pull request re-enables its bumps
+const unignoreCommand = "/valet unignore"
+
+func validateIgnoreClosed(mode string) error {
+	switch mode {
+	case "", IgnoreClosedVersion, IgnoreClosedMajor, IgnoreClosedNone:
+		return nil
+	default:
+		return errors.Errorf("Unknown ignoreClosed mode %s", mode)
+	}
+}
+
+// closedPages bounds the listing of closed pull requests. They are listed
+// from the most recently updated, so only bumps closed long ago and followed
+// by many other pull requests are no longer ignored.
+const closedPages = 5
+
+// closedBump is a bump of a pull request closed without merging
+type closedBump struct {
+	Bump
+	number int
+}
+
+// closedBumps returns the bumps of the recent valet pull requests against
+// the base branch that were closed without merging
+func (r *Releaser) closedBumps(ctx context.Context, base string) ([]closedBump, error) {
+	opts := &github.PullRequestListOptions{
+		State:       "closed",
+		Base:        base,
+		Sort:        "updated",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	bumps := []closedBump{}
+	for page := 1; ; page++ {
+		prs, res, err := r.Client.PullRequests.List(ctx, r.Repository.GetOwner().GetLogin(), r.Repository.GetName(), opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to list closed pull requests")
+		}
+		for _, pr := range prs {
+			m, ok := ParseMetadata(pr)
+			if !ok || pr.MergedAt != nil || strings.Contains(pr.GetBody(), supersededComment) {
+				continue
+			}
+			for _, b := range m.Bumps {
+				bumps = append(bumps, closedBump{Bump: b, number: pr.GetNumber()})
+			}
+		}
+		if res.NextPage == 0 || page == closedPages {
+			return bumps, nil
+		}
+		opts.Page = res.NextPage
+	}
+}
+
+// dropIgnored removes the changes of the scan that bump to a version of a
+// pull request closed without merging, unless it was re-enabled with the
+// unignore command. If the closed pull requests cannot be listed, every
+// change is kept.
+func (r *Releaser) dropIgnored(ctx context.Context, scan *Scan) {
+	mode := scan.Rule.IgnoreClosed
+	if mode == IgnoreClosedNone || len(scan.Changes) == 0 {
+		return
+	}
+
+	closed, err := r.closedBumps(ctx, scan.Rule.Branch)
+	if err != nil {
+		r.log.WithError(err).Warn("Failed to find ignored bumps")
+		return
+	}
+
+	unignored := map[int]bool{}
+	changes := []FileChange{}
+	for _, change := range scan.Changes {
+		ignored := false
+		for _, b := range closed {
+			if !ignores(mode, b.Bump, change) {
+				continue
+			}
+			ok, checked := unignored[b.number]
+			if !checked {
+				ok = r.unignored(ctx, b.number)
+				unignored[b.number] = ok
+			}
+			if !ok {
+				r.log.Infof("Skipping %s %s in %s, closed without merging in #%d", change.Name, change.New, change.File, b.number)
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			changes = append(changes, change)
+		}
+	}
+	scan.Changes = changes
+}
+
+// ignores reports whether the closed bump ignores the change
+func ignores(mode string, closed Bump, change FileChange) bool {
+	if closed.File != change.File || closed.Name != change.Name {
+		return false
+	}
+	if closed.New == change.New {
+		return true
+	}
+	if mode != IgnoreClosedMajor {
+		return false
+	}
+	closedV, err := semver.NewVersion(closed.New)
+	if err != nil {
+		return false
+	}
+	v, err := semver.NewVersion(change.New)
+	if err != nil {
+		return false
+	}
+	return closedV.Major() == v.Major()
+}
+
+// unignored reports whether a comment of the pull request re-enabled its bumps
+func (r *Releaser) unignored(ctx context.Context, number int) bool {
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, res, err := r.Client.Issues.ListComments(ctx, r.Repository.GetOwner().GetLogin(), r.Repository.GetName(), number, opts)
+		if err != nil {
+			r.log.WithError(err).Warnf("Failed to list comments of #%d", number)
+			return false
+		}
+		for _, comment := range comments {
+			if strings.HasPrefix(strings.TrimSpace(comment.GetBody()), unignoreCommand) {
+				return true
+			}
+		}
+		if res.NextPage == 0 {
+			return false
+		}
+		opts.Page = res.NextPage
+	}
+}
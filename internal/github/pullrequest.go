@@ -0,0 +1,303 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-github/v42/github"
+	"github.com/paulfarver/valet/internal/patch"
+	"github.com/pkg/errors"
+)
+
+// PullRequest is a set of changes published together on one branch. Group
+// is the name of the group of the changes, or empty for the ungrouped
+// changes of a rule.
+type PullRequest struct {
+	Branch string
+	Base   *github.Reference
+	Group  string
+	parts  []pullRequestPart
+}
+
+// PullRequestConfig sets up the pull requests opened for a rule. With
+// UpdateTypeLabels, pull requests are also labelled with the update types of
+// their changes, such as valet:major.
+//
+//	pullRequest:
+//	  labels: [dependencies]
+//	  updateTypeLabels: true
+//	  reviewers: [octocat]
+//	  teamReviewers: [platform]
+//	  assignees: [octocat]
+//	  milestone: 3
+//	  draft: true
+type PullRequestConfig struct {
+	Labels           []string `yaml:"labels"`
+	UpdateTypeLabels bool     `yaml:"updateTypeLabels"`
+	Reviewers        []string `yaml:"reviewers"`
+	TeamReviewers    []string `yaml:"teamReviewers"`
+	Assignees        []string `yaml:"assignees"`
+	Milestone        int      `yaml:"milestone"`
+	Draft            bool     `yaml:"draft"`
+}
+
+// updateTypeLabelPrefix prefixes the update type labels
+const updateTypeLabelPrefix = "valet:"
+
+func (c PullRequestConfig) Validate() error {
+	if c.Milestone < 0 {
+		return errors.Errorf("Invalid milestone %d", c.Milestone)
+	}
+	return nil
+}
+
+// labels returns the labels of the pull request described by the data
+func (c PullRequestConfig) labels(data TemplateData) []string {
+	labels := append([]string{}, c.Labels...)
+	if c.UpdateTypeLabels {
+		for _, change := range data.Changes {
+			if change.Type != "" {
+				labels = appendUnique(labels, updateTypeLabelPrefix+change.Type)
+			}
+		}
+	}
+	return labels
+}
+
+// merge combines the configs of the rules contributing to a pull request:
+// lists are joined, the first milestone wins and any draft rule makes a draft
+func (c PullRequestConfig) merge(other PullRequestConfig) PullRequestConfig {
+	for _, v := range other.Labels {
+		c.Labels = appendUnique(c.Labels, v)
+	}
+	for _, v := range other.Reviewers {
+		c.Reviewers = appendUnique(c.Reviewers, v)
+	}
+	for _, v := range other.TeamReviewers {
+		c.TeamReviewers = appendUnique(c.TeamReviewers, v)
+	}
+	for _, v := range other.Assignees {
+		c.Assignees = appendUnique(c.Assignees, v)
+	}
+	if c.Milestone == 0 {
+		c.Milestone = other.Milestone
+	}
+	c.UpdateTypeLabels = c.UpdateTypeLabels || other.UpdateTypeLabels
+	c.Draft = c.Draft || other.Draft
+	return c
+}
+
+func appendUnique(values []string, value string) []string {
+	if contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+// Config returns the pull request config of the rules contributing changes
+func (pr *PullRequest) Config() PullRequestConfig {
+	conf := PullRequestConfig{}
+	for _, part := range pr.parts {
+		conf = conf.merge(part.scan.Rule.PullRequest)
+	}
+	return conf
+}
+
+// pullRequestPart holds the changes of a pull request found by one scan
+type pullRequestPart struct {
+	scan    *Scan
+	changes []FileChange
+}
+
+func (pr *PullRequest) add(scan *Scan, change FileChange) {
+	for i := range pr.parts {
+		if pr.parts[i].scan == scan {
+			pr.parts[i].changes = append(pr.parts[i].changes, change)
+			return
+		}
+	}
+	pr.parts = append(pr.parts, pullRequestPart{scan: scan, changes: []FileChange{change}})
+}
+
+// Changes returns every change of the pull request
+func (pr *PullRequest) Changes() []FileChange {
+	changes := []FileChange{}
+	for _, part := range pr.parts {
+		changes = append(changes, part.changes...)
+	}
+	return changes
+}
+
+// commit applies the changes to the original content of their files. Files
+// changed by several rules get the edits of all of them, and the lock file
+// is regenerated by the rule that first changed the file.
+func (r *Releaser) commit(ctx context.Context, pr *PullRequest) (*Commit, error) {
+	type file struct {
+		scan    *Scan
+		edits   []patch.Edit
+		changes []FileChange
+	}
+	files := map[string]*file{}
+	for _, part := range pr.parts {
+		for _, change := range part.changes {
+			f, ok := files[change.File]
+			if !ok {
+				f = &file{scan: part.scan}
+				files[change.File] = f
+			}
+			f.edits = append(f.edits, *change.Edit)
+			f.changes = append(f.changes, change)
+		}
+	}
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	commit := NewCommit()
+	for _, p := range paths {
+		f := files[p]
+		content, err := patch.Apply(f.scan.Files[p], f.edits)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to apply changes to %s", p)
+		}
+		if err := r.updateLockFile(ctx, f.scan.Env, f.scan.Rule, f.scan.Ref, p, content, commit.Files); err != nil {
+			return nil, errors.Wrapf(err, "Failed to update lock file of %s", p)
+		}
+		commit.Files[p] = content
+		if mode := f.scan.Modes[p]; mode != "" {
+			commit.Modes[p] = mode
+		}
+		commit.Changes = append(commit.Changes, f.changes...)
+	}
+	return commit, nil
+}
+
+// publish pushes the changes of the pull request to its branch and opens the
+// pull request, or updates it if it is already open. The texts of the pull
+// request are rendered from the templates of the repository with the data,
+// and the bumps are recorded in the body so later scans recognise it.
+func (r *Releaser) publish(ctx context.Context, pr *PullRequest, data TemplateData) error {
+	owner := r.Repository.GetOwner().GetLogin()
+	repo := r.Repository.GetName()
+
+	title, err := r.templates.Title(data)
+	if err != nil {
+		return err
+	}
+	body, err := r.templates.Body(data)
+	if err != nil {
+		return err
+	}
+	metadata := pr.Metadata()
+	body, err = withMetadata(body, metadata)
+	if err != nil {
+		return err
+	}
+	message, err := r.templates.CommitMessage(data)
+	if err != nil {
+		return err
+	}
+
+	commit, err := r.commit(ctx, pr)
+	if err != nil {
+		return err
+	}
+	if err := r.pushCommit(ctx, pr.Branch, pr.Base, commit, message); err != nil {
+		return errors.Wrap(err, "Failed to commit files")
+	}
+
+	conf := pr.Config()
+	open, _, err := r.Client.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{
+		State: "open",
+		Head:  fmt.Sprintf("%s:%s", owner, pr.Branch),
+	})
+	if err != nil {
+		return errors.Wrap(err, "Failed to list pull requests")
+	}
+	method, automerge := pr.Automerge()
+	var published *github.PullRequest
+	if len(open) > 0 {
+		current := open[0]
+		// Edits trigger another scan, so an unchanged pull request is left
+		// alone, including the automerge marker of a previous scan
+		unchanged := current.GetTitle() == title &&
+			(current.GetBody() == body || automerge && withoutAutomerge(current.GetBody(), method) == body)
+		if unchanged {
+			published = current
+			body = current.GetBody()
+		} else {
+			published, _, err = r.Client.PullRequests.Edit(ctx, owner, repo, current.GetNumber(), &github.PullRequest{
+				Title: github.String(title),
+				Body:  github.String(body),
+			})
+			if err != nil {
+				return errors.Wrap(err, "Failed to update pull request")
+			}
+			r.log.Infof("Updated pull request #%d", published.GetNumber())
+		}
+	} else {
+		published, _, err = r.Client.PullRequests.Create(ctx, owner, repo, &github.NewPullRequest{
+			Title: github.String(title),
+			Head:  github.String(pr.Branch),
+			Base:  pr.Base.Ref,
+			Body:  github.String(body),
+			Draft: github.Bool(conf.Draft),
+		})
+		if err != nil {
+			return errors.Wrap(err, "Failed to create pull request")
+		}
+		r.log.Infof("Created pull request #%d", published.GetNumber())
+	}
+
+	r.decorate(ctx, published.GetNumber(), conf, data, len(open) == 0)
+	if automerge {
+		r.enableAutomerge(ctx, published, method, body)
+	} else {
+		// The body was replaced, which already dropped the marker of a
+		// previous scan
+		r.disableAutomerge(ctx, published)
+	}
+	if err := r.closeSuperseded(ctx, published, metadata); err != nil {
+		r.log.WithError(err).Warn("Failed to close superseded pull requests")
+	}
+	return nil
+}
+
+// decorate applies the labels, assignees, milestone and reviewers of the
+// config to the pull request. Failures are only logged, as the bump itself
+// is already published. Reviews are only requested on creation, so updates
+// do not request them again from reviewers who already reviewed.
+func (r *Releaser) decorate(ctx context.Context, number int, conf PullRequestConfig, data TemplateData, created bool) {
+	owner := r.Repository.GetOwner().GetLogin()
+	repo := r.Repository.GetName()
+	log := r.log.WithField("pull_request", number)
+
+	if labels := conf.labels(data); len(labels) > 0 {
+		if _, _, err := r.Client.Issues.AddLabelsToIssue(ctx, owner, repo, number, labels); err != nil {
+			log.WithError(err).Warn("Failed to add labels")
+		}
+	}
+	if len(conf.Assignees) > 0 {
+		if _, _, err := r.Client.Issues.AddAssignees(ctx, owner, repo, number, conf.Assignees); err != nil {
+			log.WithError(err).Warn("Failed to add assignees")
+		}
+	}
+	if conf.Milestone > 0 {
+		if _, _, err := r.Client.Issues.Edit(ctx, owner, repo, number, &github.IssueRequest{Milestone: github.Int(conf.Milestone)}); err != nil {
+			log.WithError(err).Warn("Failed to set milestone")
+		}
+	}
+	if created && (len(conf.Reviewers) > 0 || len(conf.TeamReviewers) > 0) {
+		_, _, err := r.Client.PullRequests.RequestReviewers(ctx, owner, repo, number, github.ReviewersRequest{
+			Reviewers:     conf.Reviewers,
+			TeamReviewers: conf.TeamReviewers,
+		})
+		if err != nil {
+			log.WithError(err).Warn("Failed to request reviewers")
+		}
+	}
+}
@@ -3,6 +3,7 @@ package github
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,22 +12,36 @@ import (
 	"strings"
 
 	"github.com/Jeffail/gabs/v2"
-	"github.com/Masterminds/semver/v3"
 	"github.com/google/go-github/v42/github"
 	"github.com/paulfarver/valet/internal/chart"
+	"github.com/paulfarver/valet/internal/image"
+	"github.com/paulfarver/valet/internal/patch"
+	"github.com/paulfarver/valet/internal/updater"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
 
 type ReleaserConfig struct {
-	Rules []RuleConfig `yaml:"rules"`
+	Rules     []RuleConfig            `yaml:"rules"`
+	Updaters  []updater.GenericConfig `yaml:"updaters"`
+	Groups    []GroupConfig           `yaml:"groups"`
+	Templates TemplatesConfig         `yaml:"templates"`
 }
 
 type RuleConfig struct {
-	Branch   string `yaml:"branch"`
-	Files    string `yaml:"files"`
-	Strategy string `yaml:"strategy"`
+	Branch   string                `yaml:"branch"`
+	Files    string                `yaml:"files"`
+	Strategy string                `yaml:"strategy"`
+	Updater  string                `yaml:"updater"`
+	Format   string                `yaml:"format"`
+	Fields   []updater.FieldConfig `yaml:"fields"`
+	Digest   string                `yaml:"digest"`
+
+	PullRequest PullRequestConfig `yaml:"pullRequest"`
+	Automerge   *AutomergeConfig  `yaml:"automerge"`
+
+	IgnoreClosed string `yaml:"ignoreClosed"`
 }
 
 type Rule struct {
@@ -34,6 +49,15 @@ type Rule struct {
 	Files    *regexp.Regexp
 	Indent   int
 	Strategy string // Has no effect yet. TODO: implement
+	Updater  string // Named updater applied to every matched document, bypassing the automated annotation
+	Format   string // Format of the matched files, detected from the file if empty
+	Fields   []updater.FieldConfig
+	Digest   updater.DigestMode // How image references are pinned by digest, unless overridden by a document
+
+	PullRequest PullRequestConfig
+	Automerge   *AutomergeConfig // Merges pull requests of allowed update types once checks pass, disabled if nil
+
+	IgnoreClosed string // How the bumps of pull requests closed without merging are skipped
 }
 
 const (
@@ -48,11 +72,15 @@ type Releaser struct {
 	Client       *github.Client
 	Repository   *github.Repository
 	Rules        []Rule
+	Groups       []GroupConfig
 	log          logrus.FieldLogger
 	chartService chart.Service
+	updaters     *updater.Registry
+	templates    *Templates
+	markers      *updater.Markers
 }
 
-func (s *Service) NewReleaser(ctx context.Context, client *github.Client, repo *github.Repository, log logrus.FieldLogger, chartService chart.Service) (*Releaser, error) {
+func (s *Service) NewReleaser(ctx context.Context, client *github.Client, repo *github.Repository, log logrus.FieldLogger, chartService chart.Service, imageService image.Service) (*Releaser, error) {
 	l := log.WithField("repository", repo.GetFullName()).WithField("component", "releaser")
 
 	file := s.config.ReleaseConfigPath
@@ -84,18 +112,64 @@ func (s *Service) NewReleaser(ctx context.Context, client *github.Client, repo *
 		return nil, errors.Wrap(err, "Failed to read rules")
 	}
 
+	updaters, err := readUpdaters(config.Updaters, chartService, imageService)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read updaters")
+	}
+
+	groups, err := readGroups(config.Groups)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read groups")
+	}
+
+	templates, err := readTemplates(config.Templates)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read templates")
+	}
+
+	for _, rule := range rules {
+		if _, ok := updaters.Named(rule.Updater); rule.Updater != "" && !ok {
+			return nil, errors.Errorf("Unknown updater %s", rule.Updater)
+		}
+		if _, ok := updaters.Format(rule.Format); rule.Format != "" && !isDocumentFormat(rule.Format) && !ok {
+			return nil, errors.Errorf("Unknown format %s", rule.Format)
+		}
+	}
+
 	return &Releaser{
 		Client:       client,
 		Repository:   repo,
 		Rules:        rules,
+		Groups:       groups,
 		log:          l,
 		chartService: chartService,
+		updaters:     updaters,
+		templates:    templates,
+		markers:      updater.NewMarkers(chartService, imageService),
 	}, nil
 }
 
 func readRules(ruleConfigs []RuleConfig) ([]Rule, error) {
 	var rules []Rule
 	for _, r := range ruleConfigs {
+		for _, f := range r.Fields {
+			if err := f.Validate(); err != nil {
+				return nil, err
+			}
+		}
+		if err := r.PullRequest.Validate(); err != nil {
+			return nil, err
+		}
+		if err := r.Automerge.Validate(); err != nil {
+			return nil, err
+		}
+		if err := validateIgnoreClosed(r.IgnoreClosed); err != nil {
+			return nil, err
+		}
+		digest, err := updater.ParseDigestMode(r.Digest)
+		if err != nil {
+			return nil, err
+		}
 		files, err := regexp.Compile(r.Files)
 		if err != nil {
 			return nil, errors.Wrapf(err, "Failed to compile files regexp %s", r.Files)
@@ -104,127 +178,441 @@ func readRules(ruleConfigs []RuleConfig) ([]Rule, error) {
 			Branch:   r.Branch,
 			Files:    files,
 			Strategy: r.Strategy,
+			Updater:  r.Updater,
+			Format:   r.Format,
+			Fields:   r.Fields,
+			Digest:   digest,
+
+			PullRequest: r.PullRequest,
+			Automerge:   r.Automerge,
+
+			IgnoreClosed: r.IgnoreClosed,
 		})
 	}
 	return rules, nil
 }
 
+// readUpdaters extends the default updaters with the generic updaters configured for the repository
+func readUpdaters(updaterConfigs []updater.GenericConfig, chartService chart.Service, imageService image.Service) (*updater.Registry, error) {
+	registry := updater.NewDefaultRegistry(chartService, imageService)
+	for _, c := range updaterConfigs {
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+		registry.Register(c.APIVersion, c.Kind, updater.NewGeneric(chartService, c))
+	}
+	return registry, nil
+}
+
+// ScanAndUpdate scans every rule and publishes the updates found, with one
+// pull request per group of updates and one for the ungrouped updates of each rule
 func (r *Releaser) ScanAndUpdate(ctx context.Context) error {
+	scans := []*Scan{}
 	for _, rule := range r.Rules {
-		if err := r.ScanAndUpdateWithRule(ctx, rule); err != nil {
-			r.log.WithError(err).Warn("Failed to scan and update with rule")
+		scan, err := r.Scan(ctx, rule)
+		if err != nil {
+			r.log.WithError(err).Warn("Failed to scan rule")
 			continue
 		}
+		scans = append(scans, scan)
 	}
+	r.publishAll(ctx, scans)
 	return nil
 }
 
 func (r *Releaser) ScanAndUpdateWithRule(ctx context.Context, rule Rule) error {
+	scan, err := r.Scan(ctx, rule)
+	if err != nil {
+		return err
+	}
+	r.publishAll(ctx, []*Scan{scan})
+	return nil
+}
+
+// Scan is the result of scanning a rule against the head of its branch. Files
+// holds the original content of every changed file and Modes its git file
+// mode, and the changes carry the edits to apply to it.
+type Scan struct {
+	Rule    Rule
+	Ref     *github.Reference
+	Env     *updater.Env
+	Files   map[string][]byte
+	Modes   map[string]string
+	Changes []FileChange
+}
+
+// Scan finds the changes bringing the files matched by the rule up to date
+func (r *Releaser) Scan(ctx context.Context, rule Rule) (*Scan, error) {
 	ref, _, err := r.Client.Git.GetRef(ctx, r.Repository.GetOwner().GetLogin(), r.Repository.GetName(), fmt.Sprintf("heads/%s", rule.Branch))
 	if err != nil {
-		return errors.Wrap(err, "Failed to get ref")
+		return nil, errors.Wrap(err, "Failed to get ref")
 	}
 
-	tree, _, err := r.Client.Git.GetTree(ctx, r.Repository.Owner.GetLogin(), r.Repository.GetName(), ref.Object.GetSHA(), true)
+	entries, err := r.listFiles(ctx, ref.Object.GetSHA(), rule.Files)
 	if err != nil {
-		return errors.Wrap(err, "Failed to get tree")
+		return nil, err
 	}
 
-	for _, entry := range tree.Entries {
-		if entry.GetType() == "blob" {
-			if rule.Files.MatchString(entry.GetPath()) {
-				r.log.Infof("Found matching file %s %s", entry.GetPath(), entry.GetSHA())
-				if err := r.UpdateFile(ctx, entry, ref); err != nil {
-					r.log.WithError(err).Warn("Failed to update file")
-				}
+	manifests := []*Manifest{}
+	for _, entry := range entries {
+		r.log.Infof("Found matching file %s %s", entry.GetPath(), entry.GetSHA())
+		m, err := r.ReadManifest(ctx, entry, rule.Format)
+		if err != nil {
+			r.log.WithError(err).Warn("Failed to read file")
+			continue
+		}
+		manifests = append(manifests, m)
+	}
+
+	documents := []*gabs.Container{}
+	for _, m := range manifests {
+		documents = append(documents, m.Documents...)
+	}
+	env := &updater.Env{
+		Log:     r.log,
+		Sources: updater.IndexSources(documents),
+		Digest:  rule.Digest,
+	}
+
+	scan := &Scan{
+		Rule:  rule,
+		Ref:   ref,
+		Env:   env,
+		Files: map[string][]byte{},
+		Modes: map[string]string{},
+	}
+	for _, m := range manifests {
+		changes, err := r.UpdateFile(ctx, env, rule, m)
+		if err != nil {
+			r.log.WithError(err).Warn("Failed to update file")
+			continue
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		scan.Files[m.Entry.GetPath()] = m.Content
+		scan.Modes[m.Entry.GetPath()] = m.Entry.GetMode()
+		scan.Changes = append(scan.Changes, changes...)
+	}
+
+	r.dropIgnored(ctx, scan)
+
+	return scan, nil
+}
+
+// publishAll splits the changes of the scans into pull requests and
+// publishes them. Branch templates may render the same branch for different
+// pull requests, which are then told apart by a hash of their default branch.
+func (r *Releaser) publishAll(ctx context.Context, scans []*Scan) {
+	used := map[string]bool{}
+	for _, pr := range r.pullRequests(scans) {
+		data := r.templateData(pr)
+		branch, err := r.templates.Branch(data, pr.Branch)
+		if err != nil {
+			r.log.WithError(err).Warnf("Failed to name branch of %s", pr.Branch)
+			continue
+		}
+		if used[branch] {
+			sum := sha256.Sum256([]byte(pr.Branch))
+			branch = fmt.Sprintf("%s-%x", branch, sum[:4])
+		}
+		used[branch] = true
+		pr.Branch = branch
+
+		if err := r.publish(ctx, pr, data); err != nil {
+			r.log.WithError(err).Warnf("Failed to publish %s", pr.Branch)
+		}
+	}
+}
+
+// pullRequests assigns every change to the pull request of its group, or to
+// the pull request of its rule if it belongs to no group. Groups are split by
+// base branch, as a pull request has a single base.
+func (r *Releaser) pullRequests(scans []*Scan) []*PullRequest {
+	prs := []*PullRequest{}
+	byBranch := map[string]*PullRequest{}
+	get := func(branch string, group string, scan *Scan) *PullRequest {
+		pr, ok := byBranch[branch]
+		if !ok {
+			pr = &PullRequest{Branch: branch, Base: scan.Ref, Group: group}
+			byBranch[branch] = pr
+			prs = append(prs, pr)
+		}
+		return pr
+	}
+
+	for _, scan := range scans {
+		for _, change := range scan.Changes {
+			if group := findGroup(r.Groups, change); group != nil {
+				get(groupBranch(scan.Rule.Branch, group.Name), group.Name, scan).add(scan, change)
+				continue
 			}
+			get(ruleBranch(scan.Rule), "", scan).add(scan, change)
 		}
 	}
-	return nil
+	return prs
+}
+
+// ruleBranch returns the branch holding the ungrouped bumps of the rule.
+// Rules are told apart by a hash of their files regexp, as they have no name.
+func ruleBranch(rule Rule) string {
+	sum := sha256.Sum256([]byte(rule.Files.String()))
+	return fmt.Sprintf("valet/%s/bump-%x", rule.Branch, sum[:4])
+}
+
+// groupBranch returns the branch holding the bumps of the group against the base branch
+func groupBranch(base, group string) string {
+	return fmt.Sprintf("valet/%s/group-%s", base, group)
+}
+
+// isDocumentFormat reports whether files of the format are decoded into
+// documents for the updaters selected by kind, rather than handled as a whole
+func isDocumentFormat(format string) bool {
+	return format == updater.FormatYAML || format == updater.FormatJSON
+}
+
+// Manifest is a file in the repository. YAML and JSON files are decoded into
+// their documents, and for YAML the node of every document is kept alongside
+// its decoded form. Changes are written back into the original content, so
+// the formatting of the file is preserved.
+type Manifest struct {
+	Entry     *github.TreeEntry
+	Format    string
+	Content   []byte
+	Documents []*gabs.Container
+	Nodes     []*yaml.Node
 }
 
-func (r *Releaser) UpdateFile(ctx context.Context, entry *github.TreeEntry, ref *github.Reference) error {
+// ReadManifest downloads and decodes the file. If format is empty it is
+// detected from the name and content of the file.
+func (r *Releaser) ReadManifest(ctx context.Context, entry *github.TreeEntry, format string) (*Manifest, error) {
 	r.log.Infof("Downloading file %s", entry.GetURL())
 	b, _, err := r.Client.Git.GetBlobRaw(ctx, r.Repository.GetOwner().GetLogin(), r.Repository.GetName(), entry.GetSHA())
 	if err != nil {
-		return errors.Wrap(err, "Failed to get file")
+		return nil, errors.Wrap(err, "Failed to get file")
+	}
+
+	if format == "" {
+		format = updater.DetectFormat(entry.GetPath(), b)
+	}
+
+	switch format {
+	case updater.FormatYAML:
+	case updater.FormatJSON:
+		doc, err := gabs.ParseJSON(b)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to decode json")
+		}
+		return &Manifest{
+			Entry:     entry,
+			Format:    format,
+			Content:   b,
+			Documents: []*gabs.Container{doc},
+		}, nil
+	default:
+		return &Manifest{
+			Entry:   entry,
+			Format:  format,
+			Content: b,
+		}, nil
 	}
 
 	reader := bytes.NewReader(b)
 	decoder := yaml.NewDecoder(reader)
 	documents := []*gabs.Container{}
+	nodes := []*yaml.Node{}
 	for {
-		var m map[string]interface{}
-		if err := decoder.Decode(&m); err != nil {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
 			if err == io.EOF {
 				break
 			}
-			return errors.Wrap(err, "Failed to decode yaml")
+			return nil, errors.Wrap(err, "Failed to decode yaml")
+		}
+		var v interface{}
+		if err := node.Decode(&v); err != nil {
+			return nil, errors.Wrap(err, "Failed to decode yaml")
 		}
-		documents = append(documents, gabs.Wrap(m))
+		documents = append(documents, gabs.Wrap(v))
+		nodes = append(nodes, &node)
+	}
+
+	return &Manifest{
+		Entry:     entry,
+		Format:    format,
+		Content:   b,
+		Documents: documents,
+		Nodes:     nodes,
+	}, nil
+}
+
+// UpdateFile returns the changes bringing the file up to date, each carrying
+// the edit of the content that applies it
+func (r *Releaser) UpdateFile(ctx context.Context, env *updater.Env, rule Rule, m *Manifest) ([]FileChange, error) {
+	if isDocumentFormat(m.Format) {
+		return r.updateDocuments(ctx, env, rule, m), nil
 	}
 
-	buf := bytes.NewBuffer([]byte{})
-	encoder := yaml.NewEncoder(buf)
-	encoder.SetIndent(2)
+	u, ok := r.updaters.Format(m.Format)
+	if !ok {
+		return nil, errors.Errorf("Unknown format %s", m.Format)
+	}
+	changes, err := u.UpdateFile(ctx, env, m.Content)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to update file")
+	}
+	applied := make([]FileChange, 0, len(changes))
+	for _, change := range changes {
+		r.log.Infof("Bumping %s from %s to %s", change.Name, change.Old, change.New)
+		applied = append(applied, FileChange{File: m.Entry.GetPath(), Change: change})
+	}
+	return applied, nil
+}
 
-	updateRequired := false
+// updateDocuments returns the changes bringing the documents of the file up
+// to date, including the fields opted in by marker comments or the rule
+// config. Those fields are owned by their marker or config, so the updater of
+// the document cannot bump them past their filter, and only the first change
+// to a field is kept so that overlapping edits never break the file.
+func (r *Releaser) updateDocuments(ctx context.Context, env *updater.Env, rule Rule, m *Manifest) []FileChange {
+	applied := []FileChange{}
+	for i, doc := range m.Documents {
+		changes := []updater.Change{}
+		owned := map[string]bool{}
+
+		if m.Nodes != nil {
+			fields, _ := updater.FindMarkers(m.Nodes[i])
+			for _, field := range fields {
+				owned[pathKey(field.Path)] = true
+			}
+			marked, err := r.markers.Update(ctx, env, m.Nodes[i])
+			if err != nil {
+				r.log.WithError(err).Warn("Failed to update marked fields")
+			}
+			changes = append(changes, marked...)
+		}
+		for _, field := range rule.Fields {
+			if path, err := updater.ParsePath(field.Path); err == nil {
+				owned[pathKey(path)] = true
+			}
+		}
+		changes = append(changes, r.markers.UpdateFields(ctx, env, doc, rule.Fields)...)
 
-	for _, doc := range documents {
-		updated, err := r.UpdateDocument(ctx, doc)
+		updated, err := r.UpdateDocument(ctx, env, rule, doc)
 		if err != nil {
-			r.log.WithError(err).Warn("Failed to update document")
-			updated = doc
-		} else {
-			updateRequired = true
+			r.log.WithError(err).Debug("Failed to update document")
+		}
+		for _, change := range updated {
+			if !owned[pathKey(change.Path)] {
+				changes = append(changes, change)
+			}
 		}
 
-		if err := encoder.Encode(updated.Data()); err != nil {
-			return errors.Wrap(err, "Failed to encode yaml")
+		seen := map[string]bool{}
+		for _, change := range changes {
+			key := pathKey(change.Path)
+			if seen[key] {
+				r.log.Warnf("Skipping %s to %s, %s is already changed", change.Name, change.New, strings.Join(change.Path, "."))
+				continue
+			}
+			seen[key] = true
+
+			r.log.Infof("Bumping %s from %s to %s", change.Name, change.Old, change.New)
+			edit, err := m.Edit(i, change)
+			if err != nil {
+				r.log.WithError(err).Warnf("Failed to set %s", strings.Join(change.Path, "."))
+				continue
+			}
+			change.Edit = &edit
+			name, namespace := objectMeta(doc, change.Path)
+			applied = append(applied, FileChange{
+				File:      m.Entry.GetPath(),
+				Document:  name,
+				Namespace: namespace,
+				Change:    change,
+			})
 		}
 	}
+	return applied
+}
 
-	if updateRequired {
-		branchName := fmt.Sprintf("valet/%s/bump", entry.GetPath())
-		if len(entry.GetPath()) > 50 {
-			branchName = fmt.Sprintf("valet/%s/bump", entry.GetPath()[len(entry.GetPath())-50:])
-		}
+// pathKey identifies the field at the path of a document
+func pathKey(path []string) string {
+	return strings.Join(path, "\x00")
+}
 
-		_, _, err := r.Client.Git.CreateRef(ctx, r.Repository.GetOwner().GetLogin(), r.Repository.GetName(), &github.Reference{
-			Ref: github.String(fmt.Sprintf("heads/%s", branchName)),
-			Object: &github.GitObject{
-				SHA: ref.Object.SHA,
-			},
-		})
-		if err != nil {
-			return errors.Wrap(err, "Failed to create ref")
-		}
-		_, _, err = r.Client.Repositories.UpdateFile(ctx, r.Repository.GetOwner().GetLogin(), r.Repository.GetName(), entry.GetPath(), &github.RepositoryContentFileOptions{
-			Message: github.String(fmt.Sprintf("Bump chart in %s", entry.GetPath())),
-			Content: buf.Bytes(),
-			Branch:  &branchName,
-			SHA:     entry.SHA,
-		})
-		if err != nil {
-			return errors.Wrap(err, "Failed to update file")
+// objectMeta returns the name and namespace of the object in the document
+// holding the field at the path, which is an item of lists
+func objectMeta(doc *gabs.Container, path []string) (string, string) {
+	obj := doc
+	for _, item := range updater.Items(doc) {
+		if len(item.Path) <= len(path) && strings.Join(path[:len(item.Path)], "/") == strings.Join(item.Path, "/") {
+			obj = item.Doc
+			break
 		}
-		_, _, err = r.Client.PullRequests.Create(ctx, r.Repository.GetOwner().GetLogin(), r.Repository.GetName(), &github.NewPullRequest{
-			Title: github.String(fmt.Sprintf("Bump chart in %s", entry.GetPath())),
-			Head:  github.String(branchName),
-			Base:  ref.Ref,
-		})
-		if err != nil {
-			return errors.Wrap(err, "Failed to create pull request")
+	}
+	name, _ := obj.Search("metadata", "name").Data().(string)
+	namespace, _ := obj.Search("metadata", "namespace").Data().(string)
+	return name, namespace
+}
+
+// Edit locates the change to the i'th document in the content of the file
+func (m *Manifest) Edit(i int, change updater.Change) (patch.Edit, error) {
+	if change.Edit != nil {
+		return *change.Edit, nil
+	}
+	if m.Format == updater.FormatJSON {
+		return patch.JSONPath(m.Content, change.Path, change.Value)
+	}
+	return patch.YAMLPath(m.Content, m.Nodes[i], change.Path, change.Value)
+}
+
+// updateLockFile adds the regenerated lock file of the updated file to files,
+// if the updater of the rule keeps a lock file and the repository has one
+func (r *Releaser) updateLockFile(ctx context.Context, env *updater.Env, rule Rule, ref *github.Reference, file string, content []byte, files map[string][]byte) error {
+	u, ok := r.updaters.Named(rule.Updater)
+	if !ok {
+		return nil
+	}
+	locker, ok := u.(updater.Locker)
+	if !ok {
+		return nil
+	}
+
+	lockFile := locker.LockFile(file)
+	rc, res, err := r.Client.Repositories.DownloadContents(ctx, r.Repository.GetOwner().GetLogin(), r.Repository.GetName(), lockFile, &github.RepositoryContentGetOptions{
+		Ref: ref.Object.GetSHA(),
+	})
+	if res != nil && res.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "no file named") {
+			return nil
 		}
+		return errors.Wrapf(err, "Failed to read %s", lockFile)
 	}
+	defer rc.Close()
+
+	lock, err := io.ReadAll(rc)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read %s", lockFile)
+	}
+
+	updated, err := locker.UpdateLock(ctx, env, content, lock)
+	if err != nil {
+		return err
+	}
+	files[lockFile] = updated
 
 	return nil
 }
 
 var ErrNotAutomated = errors.New("Not an automated release")
 
+var ErrNoUpdater = errors.New("No updater for document kind")
+
 var (
-	filterChart   = regexp.MustCompile(`^filter.valet.io/chart$`)
 	filterRegex   = regexp.MustCompile(`^filter.valet.io/(.+)$`)
 	registryRegex = regexp.MustCompile(`^registry.valet.io/(.+)$`)
 	tagRegex      = regexp.MustCompile(`^tag.valet.io/(.+)$`)
@@ -232,85 +620,64 @@ var (
 
 type updateRule struct{}
 
-func (r *Releaser) UpdateDocument(ctx context.Context, doc *gabs.Container) (*gabs.Container, error) {
-	if !doc.Exists("metadata", "annotations", "valet.io/automated") {
-		return nil, ErrNotAutomated
-	}
-
-	if doc.Search("metadata", "annotations", "valet.io/automated").Data() != "true" {
-		return nil, ErrNotAutomated
+// UpdateDocument returns the changes that bring the document up to date. Each
+// object in a top-level sequence or List kind is updated independently by the
+// updater selected for it, and the paths of its changes are made relative to
+// the document.
+func (r *Releaser) UpdateDocument(ctx context.Context, env *updater.Env, rule Rule, doc *gabs.Container) ([]updater.Change, error) {
+	items := updater.Items(doc)
+	if len(items) == 1 && len(items[0].Path) == 0 {
+		return r.updateItem(ctx, env, rule, doc)
 	}
 
-	con, _ := semver.NewConstraint(">=0.0.0")
-
-	for key, value := range doc.Search("metadata", "annotations").ChildrenMap() {
-		if filterChart.MatchString(key) {
-			str, ok := value.Data().(string)
-			if !ok {
-				return nil, errors.New("Invalid filter type")
-			}
-
-			r.log.Infof("Found filter for chart %s", str)
-
-			vals := strings.SplitN(str, ":", 2)
-			if len(vals) != 2 {
-				return nil, errors.Errorf("Invalid filter %s", str)
-			}
-
-			switch vals[0] {
-			case "semver":
-				var err error
-				con, err = semver.NewConstraint(vals[1])
-				if err != nil {
-					return nil, errors.Wrap(err, "Failed to parse constraint")
-				}
-			default:
-				return nil, errors.Errorf("Unknown filter type %s", vals[0])
-			}
+	changes := []updater.Change{}
+	for _, item := range items {
+		cs, err := r.updateItem(ctx, env, rule, item.Doc)
+		if err != nil {
+			r.log.WithError(err).Debugf("Failed to update item %s", strings.Join(item.Path, "."))
 			continue
 		}
+		for _, change := range cs {
+			if change.Path != nil {
+				change.Path = append(append([]string{}, item.Path...), change.Path...)
+			}
+			changes = append(changes, change)
+		}
 	}
+	return changes, nil
+}
 
-	name, ok := doc.Search("spec", "chart", "name").Data().(string)
-	if !ok {
-		return nil, errors.New("Failed to get chart name")
-	}
-	repo, ok := doc.Search("spec", "chart", "repository").Data().(string)
-	if !ok {
-		return nil, errors.New("Failed to get chart repository")
-	}
-	currVersion, ok := doc.Search("spec", "chart", "version").Data().(string)
-	if !ok {
-		return nil, errors.New("Failed to get chart version")
-	}
-
-	oldV, err := semver.NewVersion(currVersion)
+func (r *Releaser) updateItem(ctx context.Context, env *updater.Env, rule Rule, doc *gabs.Container) ([]updater.Change, error) {
+	u, err := r.selectUpdater(rule, doc)
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to current version")
+		return nil, err
 	}
 
-	available, err := r.chartService.ListVersions(ctx, repo, name)
-	if err != nil {
-		return nil, errors.Wrap(err, "Failed to list available chart versions")
-	}
+	return u.Update(ctx, env, doc)
+}
 
-	v := oldV
-	for _, version := range available {
-		v2, err := semver.NewVersion(version)
-		if err != nil {
-			r.log.WithError(err).Warnf("Failed to parse version %s", version)
-			continue
-		}
-		if v2.GreaterThan(v) && con.Check(v2) {
-			v = v2
+// selectUpdater returns the updater named by the rule, or otherwise the
+// updater for the kind of the document if it is marked as automated
+func (r *Releaser) selectUpdater(rule Rule, doc *gabs.Container) (updater.Updater, error) {
+	if rule.Updater != "" {
+		u, ok := r.updaters.Named(rule.Updater)
+		if !ok {
+			return nil, ErrNoUpdater
 		}
+		return u, nil
 	}
 
-	if v.Equal(oldV) {
-		return nil, errors.New("No new version found")
+	if !doc.Exists("metadata", "annotations", "valet.io/automated") {
+		return nil, ErrNotAutomated
 	}
 
-	doc.Set(v.String(), "spec", "chart", "version")
+	if doc.Search("metadata", "annotations", "valet.io/automated").Data() != "true" {
+		return nil, ErrNotAutomated
+	}
 
-	return doc, nil
+	u, ok := r.updaters.Lookup(doc)
+	if !ok {
+		return nil, ErrNoUpdater
+	}
+	return u, nil
 }
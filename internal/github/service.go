@@ -2,47 +2,197 @@ package github
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/bradleyfalzon/ghinstallation/v2"
 	"github.com/google/go-github/v42/github"
 	"github.com/paulfarver/valet/internal/chart"
+	"github.com/paulfarver/valet/internal/image"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// ErrInvalidCursor is returned for repository cursors that were not issued by ListRepositoriesPage
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
 type Service struct {
 	atr          *ghinstallation.AppsTransport
 	config       Config
 	chartService chart.Service
+	imageService image.Service
 }
 
+// Config of the GitHub app. BaseURL and UploadURL point at a GitHub
+// Enterprise Server instance, and default to github.com when empty.
+// CABundlePem adds certificate authorities trusted for the instance.
 type Config struct {
 	AppID             int64  `mapstructure:"appID"`
 	PrivateKeyPem     string `mapstructure:"privateKeyPem"`
 	ReleaseConfigPath string `mapstructure:"releaseConfig"`
+	BaseURL           string `mapstructure:"baseURL"`
+	UploadURL         string `mapstructure:"uploadURL"`
+	CABundlePem       string `mapstructure:"caBundlePem"`
 }
 
-func NewService(conf Config, chartService chart.Service) (*Service, error) {
-	atr, err := ghinstallation.NewAppsTransport(http.DefaultTransport, conf.AppID, []byte(conf.PrivateKeyPem))
+func NewService(conf Config, chartService chart.Service, imageService image.Service) (*Service, error) {
+	tr, err := newTransport(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	atr, err := ghinstallation.NewAppsTransport(tr, conf.AppID, []byte(conf.PrivateKeyPem))
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create ghinstallation.AppsTransport")
 	}
+	if conf.BaseURL != "" {
+		client, err := github.NewEnterpriseClient(conf.BaseURL, uploadURL(conf), nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to parse enterprise URLs")
+		}
+		// Installation transports inherit the API URL of the apps transport
+		atr.BaseURL = strings.TrimSuffix(client.BaseURL.String(), "/")
+	}
 
 	return &Service{
 		atr:          atr,
 		config:       conf,
 		chartService: chartService,
+		imageService: imageService,
 	}, nil
 }
 
+// newTransport returns the base transport of all requests to GitHub, trusting
+// the configured CA bundle in addition to the system roots
+func newTransport(conf Config) (http.RoundTripper, error) {
+	if conf.CABundlePem == "" {
+		return http.DefaultTransport, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM([]byte(conf.CABundlePem)) {
+		return nil, errors.New("Failed to parse CA bundle")
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return tr, nil
+}
+
+// uploadURL returns the configured upload URL, defaulting to the base URL
+// which go-github extends with the upload path of the instance
+func uploadURL(conf Config) string {
+	if conf.UploadURL != "" {
+		return conf.UploadURL
+	}
+	return conf.BaseURL
+}
+
+// newClient returns a client of the configured GitHub instance that
+// authenticates through the transport
+func (s *Service) newClient(tr http.RoundTripper) (*github.Client, error) {
+	httpClient := &http.Client{Transport: tr}
+	if s.config.BaseURL == "" {
+		return github.NewClient(httpClient), nil
+	}
+	client, err := github.NewEnterpriseClient(s.config.BaseURL, uploadURL(s.config), httpClient)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create enterprise client")
+	}
+	return client, nil
+}
+
+// installationClient returns a client authenticated as the installation
+func (s *Service) installationClient(id int64) (*github.Client, error) {
+	return s.newClient(ghinstallation.NewFromAppsTransport(s.atr, id))
+}
+
+// ListInstallations returns every installation of the app, across all pages
 func (s *Service) ListInstallations(ctx context.Context) ([]*github.Installation, error) {
-	res, _, err := github.NewClient(&http.Client{Transport: s.atr}).Apps.ListInstallations(ctx, &github.ListOptions{})
+	installations := []*github.Installation{}
+	opts := github.ListOptions{PerPage: 100}
+	for {
+		res, next, err := s.ListInstallationsPage(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		installations = append(installations, res...)
+		if next == 0 {
+			return installations, nil
+		}
+		opts.Page = next
+	}
+}
+
+// ListInstallationsPage returns a single page of installations and the number
+// of the next page, which is 0 on the last page
+func (s *Service) ListInstallationsPage(ctx context.Context, opts github.ListOptions) ([]*github.Installation, int, error) {
+	client, err := s.newClient(s.atr)
+	if err != nil {
+		return nil, 0, err
+	}
+	res, resp, err := client.Apps.ListInstallations(ctx, &opts)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "Failed to list installations")
+	}
+
+	return res, resp.NextPage, nil
+}
+
+// ListRepositoriesPage returns a page of the repositories of all
+// installations. The cursor is empty for the first page, and the returned
+// cursor of the next page is empty once every installation is listed.
+func (s *Service) ListRepositoriesPage(ctx context.Context, cursor string, perPage int) ([]*github.Repository, string, error) {
+	installations, err := s.ListInstallations(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to list installations")
+		return nil, "", err
+	}
+	if len(installations) == 0 {
+		return []*github.Repository{}, "", nil
+	}
+
+	i, page := 0, 1
+	if cursor != "" {
+		i, page, err = cursorPosition(installations, cursor)
+		if err != nil {
+			return nil, "", err
+		}
 	}
 
-	return res, nil
+	for {
+		client, err := s.installationClient(installations[i].GetID())
+		if err != nil {
+			return nil, "", err
+		}
+		res, resp, err := client.Apps.ListRepos(ctx, &github.ListOptions{Page: page, PerPage: perPage})
+		if err != nil {
+			return nil, "", errors.Wrap(err, "Failed to list repos")
+		}
+
+		next := ""
+		switch {
+		case resp.NextPage != 0:
+			next = formatCursor(installations[i].GetID(), resp.NextPage)
+		case i+1 < len(installations):
+			next = formatCursor(installations[i+1].GetID(), 1)
+		}
+
+		// Skip installations without repositories rather than returning empty pages
+		if len(res.Repositories) > 0 || next == "" {
+			return res.Repositories, next, nil
+		}
+		i, page, err = cursorPosition(installations, next)
+		if err != nil {
+			return nil, "", err
+		}
+	}
 }
 
 func (s *Service) FullScan(ctx context.Context) ([]*github.Repository, error) {
@@ -53,9 +203,10 @@ func (s *Service) FullScan(ctx context.Context) ([]*github.Repository, error) {
 
 	repositories := []*github.Repository{}
 	for _, installation := range installations {
-		transport := ghinstallation.NewFromAppsTransport(s.atr, installation.GetID())
-
-		client := github.NewClient(&http.Client{Transport: transport})
+		client, err := s.installationClient(installation.GetID())
+		if err != nil {
+			return nil, err
+		}
 		repos, err := s.ScanInstallation(ctx, client)
 		if err != nil {
 			return nil, errors.Wrap(err, "Failed to scan installation")
@@ -66,15 +217,17 @@ func (s *Service) FullScan(ctx context.Context) ([]*github.Repository, error) {
 }
 
 func (s *Service) GetReleasers(ctx context.Context, installation *github.Installation, l logrus.FieldLogger) ([]*Releaser, error) {
-	transport := ghinstallation.NewFromAppsTransport(s.atr, installation.GetID())
-	client := github.NewClient(&http.Client{Transport: transport})
-	response, _, err := client.Apps.ListRepos(ctx, nil)
+	client, err := s.installationClient(installation.GetID())
+	if err != nil {
+		return nil, err
+	}
+	repos, err := listRepos(ctx, client)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to list repositories")
 	}
 	releasers := []*Releaser{}
-	for _, repo := range response.Repositories {
-		releaser, err := s.NewReleaser(ctx, client, repo, l, s.chartService)
+	for _, repo := range repos {
+		releaser, err := s.NewReleaser(ctx, client, repo, l, s.chartService, s.imageService)
 		if err != nil {
 			l.WithError(err).WithField("repo", repo.GetFullName()).Warn("Failed to create releaser")
 			continue
@@ -85,12 +238,56 @@ func (s *Service) GetReleasers(ctx context.Context, installation *github.Install
 }
 
 func (s *Service) ScanInstallation(ctx context.Context, client *github.Client) ([]*github.Repository, error) {
-	repos, _, err := client.Apps.ListRepos(ctx, nil)
+	repos, err := listRepos(ctx, client)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to list repos")
 	}
 
-	return repos.Repositories, nil
+	return repos, nil
+}
+
+// listRepos returns every repository accessible to the installation client, across all pages
+func listRepos(ctx context.Context, client *github.Client) ([]*github.Repository, error) {
+	repos := []*github.Repository{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		res, resp, err := client.Apps.ListRepos(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, res.Repositories...)
+		if resp.NextPage == 0 {
+			return repos, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// formatCursor encodes the position of a repository page as <installation>:<page>
+func formatCursor(installation int64, page int) string {
+	return fmt.Sprintf("%d:%d", installation, page)
+}
+
+// cursorPosition returns the index of the installation and the page the cursor points at
+func cursorPosition(installations []*github.Installation, cursor string) (int, int, error) {
+	vals := strings.SplitN(cursor, ":", 2)
+	if len(vals) != 2 {
+		return 0, 0, errors.Wrap(ErrInvalidCursor, cursor)
+	}
+	id, err := strconv.ParseInt(vals[0], 10, 64)
+	if err != nil {
+		return 0, 0, errors.Wrap(ErrInvalidCursor, cursor)
+	}
+	page, err := strconv.Atoi(vals[1])
+	if err != nil || page < 1 {
+		return 0, 0, errors.Wrap(ErrInvalidCursor, cursor)
+	}
+	for i, installation := range installations {
+		if installation.GetID() == id {
+			return i, page, nil
+		}
+	}
+	return 0, 0, errors.Wrapf(ErrInvalidCursor, "Unknown installation %d", id)
 }
 
 func (s *Service) ScheduleImageUpdates(ctx context.Context, l logrus.FieldLogger) error {
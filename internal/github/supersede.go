@@ -0,0 +1,157 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-github/v42/github"
+	"github.com/pkg/errors"
+)
+
+// metadataComment holds the bumps of a pull request opened by valet in a
+// hidden comment of its body. Branch names come from templates, so the
+// comment rather than the branch tells which pull requests valet opened.
+var metadataComment = regexp.MustCompile(`<!-- valet:metadata (\{.*\}) -->`)
+
+// supersededComment marks pull requests closed by valet, as opposed to the
+// ones closed by a human to reject their bumps
+const supersededComment = "<!-- valet:superseded -->"
+
+// Metadata describes the bumps of a pull request opened by valet
+type Metadata struct {
+	Bumps []Bump `json:"bumps"`
+}
+
+// Bump is a dependency of a file moved from the Old to the New version
+type Bump struct {
+	File string `json:"file"`
+	Name string `json:"name"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+func (pr *PullRequest) Metadata() Metadata {
+	m := Metadata{Bumps: []Bump{}}
+	for _, change := range pr.Changes() {
+		m.Bumps = append(m.Bumps, Bump{File: change.File, Name: change.Name, Old: change.Old, New: change.New})
+	}
+	return m
+}
+
+// withMetadata appends the metadata comment to the body of a pull request
+func withMetadata(body string, m Metadata) (string, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to encode metadata")
+	}
+	return fmt.Sprintf("%s\n\n<!-- valet:metadata %s -->\n", strings.TrimRight(body, "\n"), b), nil
+}
+
+// ParseMetadata returns the metadata of the pull request, or false if it
+// was not opened by valet
+func ParseMetadata(pr *github.PullRequest) (Metadata, bool) {
+	var m Metadata
+	match := metadataComment.FindStringSubmatch(pr.GetBody())
+	if match == nil {
+		return m, false
+	}
+	if err := json.Unmarshal([]byte(match[1]), &m); err != nil {
+		return m, false
+	}
+	return m, true
+}
+
+// supersedes reports whether every dependency bumped by old is also bumped by
+// m, to the same or a later version. Bumps to an older version, such as after
+// a filter change, leave the pull request of the newer one open.
+func (m Metadata) supersedes(old Metadata) bool {
+	if len(old.Bumps) == 0 {
+		return false
+	}
+	bumped := map[string]string{}
+	for _, b := range m.Bumps {
+		bumped[b.File+"\x00"+b.Name] = b.New
+	}
+	for _, b := range old.Bumps {
+		version, ok := bumped[b.File+"\x00"+b.Name]
+		if !ok || !notOlder(version, b.New) {
+			return false
+		}
+	}
+	return true
+}
+
+// notOlder reports whether the version is the same as or later than old.
+// Versions that are not semver, such as digests, must be equal.
+func notOlder(version, old string) bool {
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return version == old
+	}
+	o, err := semver.NewVersion(old)
+	if err != nil {
+		return version == old
+	}
+	return !v.LessThan(o)
+}
+
+// closeSuperseded closes the open pull requests of valet against the same
+// base whose bumps are all covered by the published pull request, such as
+// the bump to an older version on another branch. Each is commented with a
+// link to the new pull request and its branch is deleted.
+func (r *Releaser) closeSuperseded(ctx context.Context, published *github.PullRequest, m Metadata) error {
+	owner := r.Repository.GetOwner().GetLogin()
+	repo := r.Repository.GetName()
+
+	opts := &github.PullRequestListOptions{
+		State:       "open",
+		Base:        published.GetBase().GetRef(),
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	superseded := []*github.PullRequest{}
+	for {
+		prs, res, err := r.Client.PullRequests.List(ctx, owner, repo, opts)
+		if err != nil {
+			return errors.Wrap(err, "Failed to list pull requests")
+		}
+		for _, pr := range prs {
+			if pr.GetNumber() == published.GetNumber() || pr.GetHead().GetRepo().GetID() != r.Repository.GetID() {
+				continue
+			}
+			if old, ok := ParseMetadata(pr); ok && m.supersedes(old) {
+				superseded = append(superseded, pr)
+			}
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+
+	for _, pr := range superseded {
+		log := r.log.WithField("pull_request", pr.GetNumber())
+		_, _, err := r.Client.Issues.CreateComment(ctx, owner, repo, pr.GetNumber(), &github.IssueComment{
+			Body: github.String(fmt.Sprintf("Superseded by #%d.", published.GetNumber())),
+		})
+		if err != nil {
+			log.WithError(err).Warn("Failed to comment on superseded pull request")
+		}
+		_, _, err = r.Client.PullRequests.Edit(ctx, owner, repo, pr.GetNumber(), &github.PullRequest{
+			State: github.String("closed"),
+			Body:  github.String(pr.GetBody() + supersededComment + "\n"),
+		})
+		if err != nil {
+			log.WithError(err).Warn("Failed to close superseded pull request")
+			continue
+		}
+		if _, err := r.Client.Git.DeleteRef(ctx, owner, repo, "heads/"+pr.GetHead().GetRef()); err != nil {
+			log.WithError(err).Warn("Failed to delete branch of superseded pull request")
+		}
+		log.Infof("Closed pull request superseded by #%d", published.GetNumber())
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package github
+
+import "testing"
+
+func TestMetadataSupersedes(t *testing.T) {
+	bump := func(name, version string) Bump {
+		return Bump{File: "values.yaml", Name: name, Old: "1.0.0", New: version}
+	}
+
+	tests := []struct {
+		name string
+		new  []Bump
+		old  []Bump
+		want bool
+	}{
+		{
+			name: "later version",
+			new:  []Bump{bump("nginx", "1.2.0")},
+			old:  []Bump{bump("nginx", "1.1.0")},
+			want: true,
+		},
+		{
+			name: "same version",
+			new:  []Bump{bump("nginx", "1.1.0")},
+			old:  []Bump{bump("nginx", "1.1.0")},
+			want: true,
+		},
+		{
+			name: "older version",
+			new:  []Bump{bump("nginx", "1.1.0")},
+			old:  []Bump{bump("nginx", "1.2.0")},
+		},
+		{
+			name: "older version of one of several",
+			new:  []Bump{bump("nginx", "1.2.0"), bump("redis", "6.0.0")},
+			old:  []Bump{bump("nginx", "1.1.0"), bump("redis", "6.2.0")},
+		},
+		{
+			name: "more dependencies",
+			new:  []Bump{bump("nginx", "1.2.0"), bump("redis", "6.2.0")},
+			old:  []Bump{bump("nginx", "1.2.0")},
+			want: true,
+		},
+		{
+			name: "missing dependency",
+			new:  []Bump{bump("nginx", "1.2.0")},
+			old:  []Bump{bump("nginx", "1.1.0"), bump("redis", "6.2.0")},
+		},
+		{
+			name: "other file",
+			new:  []Bump{{File: "other.yaml", Name: "nginx", New: "1.2.0"}},
+			old:  []Bump{bump("nginx", "1.1.0")},
+		},
+		{
+			name: "same digest",
+			new:  []Bump{bump("nginx", "sha256:abc")},
+			old:  []Bump{bump("nginx", "sha256:abc")},
+			want: true,
+		},
+		{
+			name: "other digest",
+			new:  []Bump{bump("nginx", "sha256:def")},
+			old:  []Bump{bump("nginx", "sha256:abc")},
+		},
+		{
+			name: "no bumps",
+			new:  []Bump{bump("nginx", "1.2.0")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Metadata{Bumps: tt.new}).supersedes(Metadata{Bumps: tt.old}); got != tt.want {
+				t.Errorf("supersedes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
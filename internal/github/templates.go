@@ -0,0 +1,219 @@
+package github
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/paulfarver/valet/internal/updater"
+	"github.com/pkg/errors"
+)
+
+// maxBranchLength bounds generated branch names, which are shortened with a
+// hash of the full name to stay unique
+const maxBranchLength = 100
+
+// invalidBranchChars are the characters git does not allow in ref names
+var invalidBranchChars = regexp.MustCompile(`[\x00-\x20\x7f~^:?*\[\\]+|\.\.+|@\{|//+`)
+
+// TemplatesConfig holds text/template templates for the pull requests opened
+// by valet. Templates are executed with TemplateData, and empty templates use
+// the default texts.
+//
+//	templates:
+//	  title: "chore(deps): bump {{ len .Changes }} dependencies"
+//	  branch: "deps/{{ .Base }}/{{ with .Group }}{{ . }}{{ else }}{{ .File }}{{ end }}"
+//	  body: |
+//	    {{ range .Changes }}- {{ .Name }} {{ .Old }} -> {{ .New }} in {{ .File }}
+//	    {{ end }}
+type TemplatesConfig struct {
+	CommitMessage string `yaml:"commitMessage"`
+	Title         string `yaml:"title"`
+	Body          string `yaml:"body"`
+	Branch        string `yaml:"branch"`
+}
+
+// TemplateData is the data templates are executed with. File and Change are
+// only set if the pull request changes a single file or holds a single change.
+type TemplateData struct {
+	Repository string
+	Base       string
+	Group      string
+	Files      []string
+	File       string
+	Changes    []TemplateChange
+	Change     TemplateChange
+}
+
+// TemplateChange describes a single bump. Chart and Image repeat the name of
+// the bumped chart or image, and Type is the update type such as minor.
+type TemplateChange struct {
+	File      string
+	Document  string
+	Namespace string
+	Kind      string
+	Name      string
+	Chart     string
+	Image     string
+	Old       string
+	New       string
+	Type      string
+}
+
+// Templates are the parsed templates of a repository
+type Templates struct {
+	commitMessage *template.Template
+	title         *template.Template
+	body          *template.Template
+	branch        *template.Template
+}
+
+func readTemplates(conf TemplatesConfig) (*Templates, error) {
+	t := &Templates{}
+	for _, tmpl := range []struct {
+		name string
+		text string
+		dst  **template.Template
+	}{
+		{"commitMessage", conf.CommitMessage, &t.commitMessage},
+		{"title", conf.Title, &t.title},
+		{"body", conf.Body, &t.body},
+		{"branch", conf.Branch, &t.branch},
+	} {
+		if tmpl.text == "" {
+			continue
+		}
+		parsed, err := template.New(tmpl.name).Option("missingkey=error").Parse(tmpl.text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse %s template", tmpl.name)
+		}
+		*tmpl.dst = parsed
+	}
+	return t, nil
+}
+
+// templateData returns the data describing the pull request
+func (r *Releaser) templateData(pr *PullRequest) TemplateData {
+	data := TemplateData{
+		Repository: r.Repository.GetFullName(),
+		Base:       strings.TrimPrefix(pr.Base.GetRef(), "refs/heads/"),
+		Group:      pr.Group,
+		Changes:    []TemplateChange{},
+	}
+
+	files := map[string]bool{}
+	for _, change := range pr.Changes() {
+		c := TemplateChange{
+			File:      change.File,
+			Document:  change.Document,
+			Namespace: change.Namespace,
+			Kind:      change.Kind,
+			Name:      change.Name,
+			Old:       change.Old,
+			New:       change.New,
+			Type:      updater.UpdateType(change.Change),
+		}
+		switch change.Kind {
+		case updater.KindChart:
+			c.Chart = change.Name
+		case updater.KindImage:
+			c.Image = change.Name
+		}
+		data.Changes = append(data.Changes, c)
+		if !files[change.File] {
+			files[change.File] = true
+			data.Files = append(data.Files, change.File)
+		}
+	}
+	sort.Strings(data.Files)
+
+	if len(data.Files) == 1 {
+		data.File = data.Files[0]
+	}
+	if len(data.Changes) == 1 {
+		data.Change = data.Changes[0]
+	}
+	return data
+}
+
+// execute renders the template with the data, or returns def if the template is not set
+func execute(tmpl *template.Template, data TemplateData, def string) (string, error) {
+	if tmpl == nil {
+		return def, nil
+	}
+	b := bytes.Buffer{}
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", errors.Wrapf(err, "Failed to execute %s template", tmpl.Name())
+	}
+	return b.String(), nil
+}
+
+func (t *Templates) Title(data TemplateData) (string, error) {
+	title, err := execute(t.title, data, defaultTitle(data))
+	return strings.TrimSpace(title), err
+}
+
+func (t *Templates) Body(data TemplateData) (string, error) {
+	return execute(t.body, data, defaultBody(data))
+}
+
+// CommitMessage defaults to the title of the pull request
+func (t *Templates) CommitMessage(data TemplateData) (string, error) {
+	if t.commitMessage == nil {
+		return t.Title(data)
+	}
+	return execute(t.commitMessage, data, "")
+}
+
+// Branch renders the branch of the pull request, falling back to def. The
+// result is turned into a valid ref name, and long names are shortened.
+func (t *Templates) Branch(data TemplateData, def string) (string, error) {
+	branch, err := execute(t.branch, data, def)
+	if err != nil {
+		return "", err
+	}
+	branch = invalidBranchChars.ReplaceAllString(strings.TrimSpace(branch), "-")
+	branch = strings.Trim(strings.TrimSuffix(branch, ".lock"), "/.-")
+	if branch == "" {
+		return "", errors.New("Branch template rendered an empty branch name")
+	}
+	return shortenBranch(branch), nil
+}
+
+// shortenBranch cuts names longer than maxBranchLength, keeping them unique
+// with a hash of the full name
+func shortenBranch(branch string) string {
+	if len(branch) <= maxBranchLength {
+		return branch
+	}
+	sum := sha256.Sum256([]byte(branch))
+	return fmt.Sprintf("%s-%x", strings.TrimRight(branch[:maxBranchLength-9], "/.-"), sum[:4])
+}
+
+func defaultTitle(data TemplateData) string {
+	if data.Group != "" {
+		if len(data.Changes) == 1 {
+			return fmt.Sprintf("Bump the %s group with 1 update", data.Group)
+		}
+		return fmt.Sprintf("Bump the %s group with %d updates", data.Group, len(data.Changes))
+	}
+	if data.File != "" {
+		return fmt.Sprintf("Bump dependencies in %s", data.File)
+	}
+	return fmt.Sprintf("Bump dependencies in %d files", len(data.Files))
+}
+
+// defaultBody lists every bump of the pull request in a table
+func defaultBody(data TemplateData) string {
+	b := strings.Builder{}
+	b.WriteString("| Dependency | File | From | To |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+	for _, change := range data.Changes {
+		fmt.Fprintf(&b, "| %s | %s | `%s` | `%s` |\n", change.Name, change.File, change.Old, change.New)
+	}
+	return b.String()
+}
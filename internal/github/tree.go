@@ -0,0 +1,88 @@
+package github
+
+import (
+	"context"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/google/go-github/v42/github"
+	"github.com/pkg/errors"
+)
+
+// listFiles returns the entries of every blob in the tree whose path matches
+// the files regexp. GitHub truncates recursive trees of large repositories,
+// in which case the tree is walked one level at a time instead, skipping the
+// directories that cannot contain a match.
+func (r *Releaser) listFiles(ctx context.Context, sha string, files *regexp.Regexp) ([]*github.TreeEntry, error) {
+	owner := r.Repository.GetOwner().GetLogin()
+	repo := r.Repository.GetName()
+
+	tree, _, err := r.Client.Git.GetTree(ctx, owner, repo, sha, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get tree")
+	}
+
+	entries := []*github.TreeEntry{}
+	if !tree.GetTruncated() {
+		for _, entry := range tree.Entries {
+			if entry.GetType() == "blob" && files.MatchString(entry.GetPath()) {
+				entries = append(entries, entry)
+			}
+		}
+		return entries, nil
+	}
+
+	r.log.Infof("Tree %s is truncated, walking it non-recursively", sha)
+	err = r.walkTree(ctx, sha, "", literalPrefix(files), files, &entries)
+	return entries, err
+}
+
+func (r *Releaser) walkTree(ctx context.Context, sha, dir, prefix string, files *regexp.Regexp, entries *[]*github.TreeEntry) error {
+	tree, _, err := r.Client.Git.GetTree(ctx, r.Repository.GetOwner().GetLogin(), r.Repository.GetName(), sha, false)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get tree of %s", dir)
+	}
+
+	for _, entry := range tree.Entries {
+		path := dir + entry.GetPath()
+		switch entry.GetType() {
+		case "blob":
+			if files.MatchString(path) {
+				// Entries of a non-recursive tree are relative to it
+				entry.Path = github.String(path)
+				*entries = append(*entries, entry)
+			}
+		case "tree":
+			if !strings.HasPrefix(path+"/", prefix) && !strings.HasPrefix(prefix, path+"/") {
+				continue
+			}
+			if err := r.walkTree(ctx, entry.GetSHA(), path+"/", prefix, files, entries); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// literalPrefix returns the literal text every matching path starts with,
+// which only exists for expressions anchored at the start like ^deploy/.*
+func literalPrefix(re *regexp.Regexp) string {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	parsed = parsed.Simplify()
+	if parsed.Op != syntax.OpConcat || len(parsed.Sub) < 2 || parsed.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+
+	prefix := strings.Builder{}
+	for _, sub := range parsed.Sub[1:] {
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			break
+		}
+		prefix.WriteString(string(sub.Rune))
+	}
+	return prefix.String()
+}
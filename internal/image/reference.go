@@ -0,0 +1,77 @@
+package image
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Reference is a parsed image reference such as
+// registry.example.com:5000/org/app:1.2.3@sha256:abc
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference splits an image reference into its parts. The registry is
+// only set if the first path component looks like a host, following the same
+// rules as docker: it contains a dot or a port, or is localhost.
+func ParseReference(ref string) (*Reference, error) {
+	if ref == "" {
+		return nil, errors.New("Empty image reference")
+	}
+
+	r := &Reference{}
+	rest := ref
+
+	if i := strings.Index(rest, "@"); i >= 0 {
+		r.Digest = rest[i+1:]
+		rest = rest[:i]
+		if !strings.Contains(r.Digest, ":") {
+			return nil, errors.Errorf("Invalid digest in image reference %s", ref)
+		}
+	}
+
+	// A colon after the last slash separates the tag, earlier colons belong to a registry port
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		r.Tag = rest[i+1:]
+		rest = rest[:i]
+	}
+
+	if i := strings.Index(rest, "/"); i >= 0 {
+		host := rest[:i]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			r.Registry = host
+			rest = rest[i+1:]
+		}
+	}
+
+	if rest == "" {
+		return nil, errors.Errorf("Missing repository in image reference %s", ref)
+	}
+	r.Repository = rest
+
+	return r, nil
+}
+
+// Name returns the registry and repository of the reference
+func (r *Reference) Name() string {
+	if r.Registry == "" {
+		return r.Repository
+	}
+	return r.Registry + "/" + r.Repository
+}
+
+// String formats the reference as it would appear in a manifest
+func (r *Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
@@ -0,0 +1,231 @@
+package image
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	dockerHubRegistry = "registry-1.docker.io"
+
+	mediaTypeOCIIndex         = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerList       = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest      = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerManifest   = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerContentDigestHeader = "Docker-Content-Digest"
+	authenticateHeader        = "Www-Authenticate"
+)
+
+// manifestAccept lists the index types first, so registries serve the
+// multi-arch index of a tag rather than the manifest of a single platform
+var manifestAccept = strings.Join([]string{
+	mediaTypeOCIIndex,
+	mediaTypeDockerList,
+	mediaTypeOCIManifest,
+	mediaTypeDockerManifest,
+}, ", ")
+
+var (
+	challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+	nextLink       = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+)
+
+// RegistryService talks to container registries through the registry HTTP
+// API, authenticating anonymously with bearer tokens where required
+type RegistryService struct {
+	client *http.Client
+}
+
+func NewRegistryService(client *http.Client) *RegistryService {
+	return &RegistryService{
+		client: client,
+	}
+}
+
+// endpoint returns the registry host and repository path of an image name,
+// resolving names without a registry to Docker Hub
+func endpoint(repository string) (string, string, error) {
+	ref, err := ParseReference(repository)
+	if err != nil {
+		return "", "", err
+	}
+
+	host, path := ref.Registry, ref.Repository
+	if host == "" || host == "docker.io" || host == "index.docker.io" {
+		host = dockerHubRegistry
+		if !strings.Contains(path, "/") {
+			path = "library/" + path
+		}
+	}
+	return host, path, nil
+}
+
+func (s *RegistryService) ListTags(ctx context.Context, repository string) ([]string, error) {
+	host, path, err := endpoint(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	next := fmt.Sprintf("https://%s/v2/%s/tags/list", host, path)
+	for next != "" {
+		res, err := s.do(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to list tags")
+		}
+
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&body)
+		res.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to decode tags")
+		}
+		tags = append(tags, body.Tags...)
+
+		next = ""
+		if m := nextLink.FindStringSubmatch(res.Header.Get("Link")); m != nil {
+			u, err := res.Request.URL.Parse(m[1])
+			if err != nil {
+				return nil, errors.Wrap(err, "Failed to parse next link")
+			}
+			next = u.String()
+		}
+	}
+
+	return tags, nil
+}
+
+// Digest returns the digest of the manifest the tag points at. For multi-arch
+// images this is the digest of the image index or manifest list, so pinning
+// it keeps the image pullable on every platform.
+func (s *RegistryService) Digest(ctx context.Context, repository, tag string) (string, error) {
+	host, path, err := endpoint(repository)
+	if err != nil {
+		return "", err
+	}
+
+	u := fmt.Sprintf("https://%s/v2/%s/manifests/%s", host, path, tag)
+	header := http.Header{"Accept": []string{manifestAccept}}
+
+	res, err := s.do(ctx, http.MethodHead, u, header)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get manifest")
+	}
+	res.Body.Close()
+	if digest := res.Header.Get(dockerContentDigestHeader); digest != "" {
+		return digest, nil
+	}
+
+	// Not every registry sets the digest header, the digest is then computed from the manifest itself
+	res, err = s.do(ctx, http.MethodGet, u, header)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get manifest")
+	}
+	defer res.Body.Close()
+	if digest := res.Header.Get(dockerContentDigestHeader); digest != "" {
+		return digest, nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, res.Body); err != nil {
+		return "", errors.Wrap(err, "Failed to read manifest")
+	}
+	return fmt.Sprintf("sha256:%x", hash.Sum(nil)), nil
+}
+
+// do performs the request, fetching an anonymous bearer token and retrying
+// once if the registry challenges for one
+func (s *RegistryService) do(ctx context.Context, method, u string, header http.Header) (*http.Response, error) {
+	res, err := s.request(ctx, method, u, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusUnauthorized {
+		res.Body.Close()
+		token, err := s.token(ctx, res.Header.Get(authenticateHeader))
+		if err != nil {
+			return nil, err
+		}
+		header = header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Set("Authorization", "Bearer "+token)
+		res, err = s.request(ctx, method, u, header)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, errors.Errorf("Unexpected status %s from %s", res.Status, u)
+	}
+	return res, nil
+}
+
+func (s *RegistryService) request(ctx context.Context, method, u string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	return s.client.Do(req)
+}
+
+// token fetches an anonymous token for the bearer challenge of a registry
+func (s *RegistryService) token(ctx context.Context, challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", errors.Errorf("Unsupported authentication challenge %s", challenge)
+	}
+
+	params := map[string]string{}
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", errors.Errorf("Invalid realm in challenge %s", challenge)
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	res, err := s.request(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get token")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("Unexpected status %s when getting token", res.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", errors.Wrap(err, "Failed to decode token")
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
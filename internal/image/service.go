@@ -1,9 +1,39 @@
 package image
 
-import "context"
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Config selects the image service. The mock with fixed tags is used unless
+// Registry enables querying container registries, whose requests time out
+// after Timeout, 30 seconds by default.
+type Config struct {
+	Registry bool          `mapstructure:"registry"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
 
 type Service interface {
 	ListTags(ctx context.Context, repository string) ([]string, error)
+	// Digest returns the manifest digest the tag currently points at. For
+	// multi-arch images this is the digest of the image index, not of the
+	// manifest of a single platform.
+	Digest(ctx context.Context, repository, tag string) (string, error)
+}
+
+// NewService returns the image service selected by the config
+func NewService(conf Config) Service {
+	if !conf.Registry {
+		return NewServiceMock()
+	}
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	return NewRegistryService(&http.Client{Timeout: timeout})
 }
 
 type ServiceMock struct{}
@@ -15,3 +45,7 @@ func NewServiceMock() Service {
 func (s *ServiceMock) ListTags(ctx context.Context, repository string) ([]string, error) {
 	return []string{"1.0.0", "1.0.1"}, nil
 }
+
+func (s *ServiceMock) Digest(ctx context.Context, repository, tag string) (string, error) {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(repository+":"+tag))), nil
+}
@@ -0,0 +1,124 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// jsonFrame is an object or array the JSON decoder is currently inside
+type jsonFrame struct {
+	object    bool
+	expectKey bool
+	key       string
+	index     int
+}
+
+func (f *jsonFrame) segment() string {
+	if f.object {
+		return f.key
+	}
+	return strconv.Itoa(f.index)
+}
+
+// JSONPath returns the edit that sets the string at the path of object keys
+// and array indices to the value. Only the characters inside the quotes are
+// replaced, so indentation and key order of the file are preserved.
+func JSONPath(content []byte, path []string, value string) (Edit, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	stack := []*jsonFrame{}
+
+	// matches reports whether the value being decoded is the one at the path
+	matches := func() bool {
+		if len(stack) != len(path) {
+			return false
+		}
+		for i, f := range stack {
+			if f.segment() != path[i] {
+				return false
+			}
+		}
+		return true
+	}
+	// consumed moves the innermost container past the value just decoded
+	consumed := func() {
+		if len(stack) == 0 {
+			return
+		}
+		top := stack[len(stack)-1]
+		if top.object {
+			top.expectKey = true
+		} else {
+			top.index++
+		}
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Edit{}, errors.Wrap(err, "Failed to decode json")
+		}
+
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if top.object && top.expectKey {
+				if key, ok := token.(string); ok {
+					top.key = key
+					top.expectKey = false
+					continue
+				}
+			}
+		}
+
+		switch t := token.(type) {
+		case json.Delim:
+			switch t {
+			case '{':
+				stack = append(stack, &jsonFrame{object: true, expectKey: true})
+			case '[':
+				stack = append(stack, &jsonFrame{})
+			default:
+				stack = stack[:len(stack)-1]
+				consumed()
+			}
+		case string:
+			if matches() {
+				return jsonStringEdit(content, int(decoder.InputOffset()), t, value)
+			}
+			consumed()
+		default:
+			if matches() {
+				return Edit{}, errors.Errorf("Value at %v is not a string", path)
+			}
+			consumed()
+		}
+	}
+
+	return Edit{}, errors.Errorf("Path %v not found", path)
+}
+
+// jsonStringEdit returns the edit replacing the string that ends at the offset
+func jsonStringEdit(content []byte, end int, current, value string) (Edit, error) {
+	start := end - len(current) - 2
+	if start < 0 || string(content[start:end]) != strconv.Quote(current) {
+		return Edit{}, errors.New("String does not match its source")
+	}
+
+	quoted, err := json.Marshal(value)
+	if err != nil {
+		return Edit{}, err
+	}
+
+	return Edit{
+		Offset: start + 1,
+		Length: len(current),
+		Text:   string(quoted[1 : len(quoted)-1]),
+	}, nil
+}
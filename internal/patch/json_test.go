@@ -0,0 +1,114 @@
+package patch
+
+import "testing"
+
+func TestJSONPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		path    []string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "top-level key",
+			content: "{\n  \"version\": \"1.0.0\"\n}\n",
+			path:    []string{"version"},
+			value:   "1.1.0",
+			want:    "{\n  \"version\": \"1.1.0\"\n}\n",
+		},
+		{
+			name:    "nested key after objects and arrays",
+			content: `{"name": "app", "meta": {"tags": ["a", "b"], "n": 1}, "image": {"tag": "1.20", "repository": "nginx"}}`,
+			path:    []string{"image", "tag"},
+			value:   "1.21",
+			want:    `{"name": "app", "meta": {"tags": ["a", "b"], "n": 1}, "image": {"tag": "1.21", "repository": "nginx"}}`,
+		},
+		{
+			name:    "key matching a value elsewhere",
+			content: `{"a": "tag", "tag": "1.20"}`,
+			path:    []string{"tag"},
+			value:   "1.21",
+			want:    `{"a": "tag", "tag": "1.21"}`,
+		},
+		{
+			name:    "same key in another object",
+			content: `{"sidecar": {"tag": "1.0"}, "app": {"tag": "1.20"}}`,
+			path:    []string{"app", "tag"},
+			value:   "1.21",
+			want:    `{"sidecar": {"tag": "1.0"}, "app": {"tag": "1.21"}}`,
+		},
+		{
+			name:    "array index",
+			content: `{"images": [{"tag": "1.0"}, {"tag": "2.0"}]}`,
+			path:    []string{"images", "1", "tag"},
+			value:   "2.1",
+			want:    `{"images": [{"tag": "1.0"}, {"tag": "2.1"}]}`,
+		},
+		{
+			name:    "index after nested array",
+			content: `{"a": [[1, 2], "x", "y"]}`,
+			path:    []string{"a", "2"},
+			value:   "z",
+			want:    `{"a": [[1, 2], "x", "z"]}`,
+		},
+		{
+			name:    "escaped value",
+			content: `{"tag": "1.20"}`,
+			path:    []string{"tag"},
+			value:   `a"b`,
+			want:    `{"tag": "a\"b"}`,
+		},
+		{
+			name:    "not a string",
+			content: `{"replicas": 1}`,
+			path:    []string{"replicas"},
+			value:   "2",
+			wantErr: true,
+		},
+		{
+			name:    "escaped source",
+			content: `{"tag": "1.\u00320"}`,
+			path:    []string{"tag"},
+			value:   "1.21",
+			wantErr: true,
+		},
+		{
+			name:    "missing path",
+			content: `{"image": {"tag": "1.20"}}`,
+			path:    []string{"image", "digest"},
+			value:   "sha256:abc",
+			wantErr: true,
+		},
+		{
+			name:    "invalid json",
+			content: `{"tag": }`,
+			path:    []string{"tag"},
+			value:   "1.21",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edit, err := JSONPath([]byte(tt.content), tt.path, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("JSONPath() = %+v, want error", edit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("JSONPath() error = %v", err)
+			}
+			got, err := Apply([]byte(tt.content), []Edit{edit})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("JSONPath() applied = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package patch
+
+import (
+	"bytes"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Edit replaces Length bytes at Offset of a file with Text
+type Edit struct {
+	Offset int
+	Length int
+	Text   string
+}
+
+// Apply returns a copy of the content with the edits applied. Edits must not
+// overlap, except for duplicates which are applied once, but may be given in
+// any order.
+func Apply(content []byte, edits []Edit) ([]byte, error) {
+	sorted := append([]Edit{}, edits...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Offset < sorted[j].Offset
+	})
+
+	out := make([]byte, 0, len(content))
+	pos := 0
+	for i, e := range sorted {
+		if i > 0 && e == sorted[i-1] {
+			continue
+		}
+		if e.Offset < pos || e.Offset+e.Length > len(content) {
+			return nil, errors.Errorf("Edit at offset %d overlaps or is out of range", e.Offset)
+		}
+		out = append(out, content[pos:e.Offset]...)
+		out = append(out, e.Text...)
+		pos = e.Offset + e.Length
+	}
+	out = append(out, content[pos:]...)
+
+	return out, nil
+}
+
+// Offset converts a 1-based line and column, counted in characters, into a
+// byte offset in the content
+func Offset(content []byte, line, column int) (int, error) {
+	offset := 0
+	for l := 1; l < line; l++ {
+		i := bytes.IndexByte(content[offset:], '\n')
+		if i < 0 {
+			return 0, errors.Errorf("Line %d is out of range", line)
+		}
+		offset += i + 1
+	}
+
+	for c := 1; c < column; c++ {
+		if offset >= len(content) || content[offset] == '\n' {
+			return 0, errors.Errorf("Column %d is out of range on line %d", column, line)
+		}
+		_, size := utf8.DecodeRune(content[offset:])
+		offset += size
+	}
+
+	return offset, nil
+}
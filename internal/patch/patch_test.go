@@ -0,0 +1,170 @@
+package patch
+
+import "testing"
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		edits   []Edit
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "no edits",
+			content: "image: nginx:1.20\n",
+			want:    "image: nginx:1.20\n",
+		},
+		{
+			name:    "single edit",
+			content: "image: nginx:1.20\n",
+			edits:   []Edit{{Offset: 13, Length: 4, Text: "1.21.6"}},
+			want:    "image: nginx:1.21.6\n",
+		},
+		{
+			name:    "unordered edits",
+			content: "a: 1\nb: 2\n",
+			edits: []Edit{
+				{Offset: 8, Length: 1, Text: "20"},
+				{Offset: 3, Length: 1, Text: "10"},
+			},
+			want: "a: 10\nb: 20\n",
+		},
+		{
+			name:    "insertion",
+			content: "nginx:1.20",
+			edits:   []Edit{{Offset: 10, Text: "@sha256:abc"}},
+			want:    "nginx:1.20@sha256:abc",
+		},
+		{
+			name:    "duplicates are applied once",
+			content: "a: 1\n",
+			edits: []Edit{
+				{Offset: 3, Length: 1, Text: "2"},
+				{Offset: 3, Length: 1, Text: "2"},
+			},
+			want: "a: 2\n",
+		},
+		{
+			name:    "overlap",
+			content: "a: 123\n",
+			edits: []Edit{
+				{Offset: 3, Length: 2, Text: "4"},
+				{Offset: 4, Length: 2, Text: "5"},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "same offset with different text",
+			content: "a: 1\n",
+			edits: []Edit{
+				{Offset: 3, Length: 1, Text: "2"},
+				{Offset: 3, Length: 1, Text: "3"},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "out of range",
+			content: "a: 1\n",
+			edits:   []Edit{{Offset: 4, Length: 2, Text: "2"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.content), tt.edits)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Apply() = %q, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOffset(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    int
+		column  int
+		want    int
+		wantErr bool
+	}{
+		{
+			name:    "start",
+			content: "a: 1\nb: 2\n",
+			line:    1,
+			column:  1,
+			want:    0,
+		},
+		{
+			name:    "second line",
+			content: "a: 1\nb: 2\n",
+			line:    2,
+			column:  4,
+			want:    8,
+		},
+		{
+			name:    "multi-byte characters count as one column",
+			content: "# æøå\nname: ø: x\n",
+			line:    2,
+			column:  10,
+			want:    19,
+		},
+		{
+			name:    "multi-byte characters on earlier lines",
+			content: "# 日本\na: 1\n",
+			line:    2,
+			column:  4,
+			want:    12,
+		},
+		{
+			name:    "end of line",
+			content: "a: 1\n",
+			line:    1,
+			column:  5,
+			want:    4,
+		},
+		{
+			name:    "line out of range",
+			content: "a: 1\n",
+			line:    3,
+			column:  1,
+			wantErr: true,
+		},
+		{
+			name:    "column past the end of line",
+			content: "a: 1\nb: 2\n",
+			line:    1,
+			column:  7,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Offset([]byte(tt.content), tt.line, tt.column)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Offset() = %d, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Offset() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Offset() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
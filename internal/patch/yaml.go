@@ -0,0 +1,100 @@
+package patch
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Lookup finds the node at the path of mapping keys and sequence indices
+func Lookup(node *yaml.Node, path []string) (*yaml.Node, error) {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for _, seg := range path {
+		switch node.Kind {
+		case yaml.MappingNode:
+			var next *yaml.Node
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == seg {
+					next = node.Content[i+1]
+					break
+				}
+			}
+			if next == nil {
+				return nil, errors.Errorf("Key %s not found", seg)
+			}
+			node = next
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node.Content) {
+				return nil, errors.Errorf("Invalid sequence index %s", seg)
+			}
+			node = node.Content[i]
+		default:
+			return nil, errors.Errorf("Cannot descend into %s", seg)
+		}
+	}
+
+	return node, nil
+}
+
+// YAMLScalar returns the edit that replaces the value of a single line scalar
+// node in the content it was parsed from. Everything else in the file,
+// including comments, quoting and indentation, is left untouched.
+func YAMLScalar(content []byte, node *yaml.Node, value string) (Edit, error) {
+	if node.Kind != yaml.ScalarNode {
+		return Edit{}, errors.New("Node is not a scalar")
+	}
+
+	offset, err := Offset(content, node.Line, node.Column)
+	if err != nil {
+		return Edit{}, err
+	}
+
+	text := value
+	switch node.Style {
+	case yaml.DoubleQuotedStyle, yaml.SingleQuotedStyle:
+		// Skip the opening quote, the quotes themselves are kept
+		offset++
+	case 0:
+		if !isPlainString(value) {
+			text = strconv.Quote(value)
+		}
+	default:
+		return Edit{}, errors.Errorf("Unsupported scalar style on line %d", node.Line)
+	}
+
+	end := offset + len(node.Value)
+	if end > len(content) || string(content[offset:end]) != node.Value {
+		return Edit{}, errors.Errorf("Scalar on line %d does not match its source", node.Line)
+	}
+
+	return Edit{
+		Offset: offset,
+		Length: len(node.Value),
+		Text:   text,
+	}, nil
+}
+
+// YAMLPath returns the edit that sets the scalar at the path to the value
+func YAMLPath(content []byte, doc *yaml.Node, path []string, value string) (Edit, error) {
+	node, err := Lookup(doc, path)
+	if err != nil {
+		return Edit{}, err
+	}
+	return YAMLScalar(content, node, value)
+}
+
+// isPlainString reports whether the value reads back as the same string when
+// written as a plain scalar, e.g. 1.10 would turn into a float
+func isPlainString(value string) bool {
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(value), &v); err != nil {
+		return false
+	}
+	s, ok := v.(string)
+	return ok && s == value
+}
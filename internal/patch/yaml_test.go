@@ -0,0 +1,156 @@
+package patch
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestYAMLPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		path    []string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "plain",
+			content: "image:\n  tag: 1.20 # pinned\n",
+			path:    []string{"image", "tag"},
+			value:   "1.21.6",
+			want:    "image:\n  tag: 1.21.6 # pinned\n",
+		},
+		{
+			name:    "plain value that is not a string",
+			content: "tag: v1\n",
+			path:    []string{"tag"},
+			value:   "1.10",
+			want:    "tag: \"1.10\"\n",
+		},
+		{
+			name:    "double quoted",
+			content: "tag: \"1.20\"\n",
+			path:    []string{"tag"},
+			value:   "1.21",
+			want:    "tag: \"1.21\"\n",
+		},
+		{
+			name:    "single quoted",
+			content: "tag: '1.20'\n",
+			path:    []string{"tag"},
+			value:   "1.21",
+			want:    "tag: '1.21'\n",
+		},
+		{
+			name:    "sequence",
+			content: "containers:\n  - name: app\n    image: nginx:1.20\n  - name: sidecar\n    image: envoy:1.20\n",
+			path:    []string{"containers", "1", "image"},
+			value:   "envoy:1.21",
+			want:    "containers:\n  - name: app\n    image: nginx:1.20\n  - name: sidecar\n    image: envoy:1.21\n",
+		},
+		{
+			name:    "multi-byte characters before the value",
+			content: "description: æøå\nlabels: {team: æøå, version: 1.0.0}\n",
+			path:    []string{"labels", "version"},
+			value:   "1.1.0",
+			want:    "description: æøå\nlabels: {team: æøå, version: 1.1.0}\n",
+		},
+		{
+			name:    "literal block",
+			content: "script: |\n  echo 1.20\n",
+			path:    []string{"script"},
+			value:   "echo 1.21",
+			wantErr: true,
+		},
+		{
+			name:    "not a scalar",
+			content: "image:\n  tag: 1.20\n",
+			path:    []string{"image"},
+			value:   "1.21",
+			wantErr: true,
+		},
+		{
+			name:    "missing key",
+			content: "image:\n  tag: 1.20\n",
+			path:    []string{"image", "repository"},
+			value:   "nginx",
+			wantErr: true,
+		},
+		{
+			name:    "invalid index",
+			content: "tags: [1.20]\n",
+			path:    []string{"tags", "1"},
+			value:   "1.21",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.content), &doc); err != nil {
+				t.Fatal(err)
+			}
+			edit, err := YAMLPath([]byte(tt.content), &doc, tt.path, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("YAMLPath() = %+v, want error", edit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("YAMLPath() error = %v", err)
+			}
+			got, err := Apply([]byte(tt.content), []Edit{edit})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("YAMLPath() applied = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestYAMLScalarMultipleDocuments(t *testing.T) {
+	content := []byte("image: nginx:1.20\n---\n# second\nimage: nginx:1.20\n---\nimage: 'nginx:1.20'\n")
+	want := "image: nginx:1.20\n---\n# second\nimage: nginx:1.21\n---\nimage: 'nginx:1.22'\n"
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	docs := []*yaml.Node{}
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, &doc)
+	}
+	if len(docs) != 3 {
+		t.Fatalf("decoded %d documents, want 3", len(docs))
+	}
+
+	edits := []Edit{}
+	for i, value := range map[int]string{1: "nginx:1.21", 2: "nginx:1.22"} {
+		edit, err := YAMLPath(content, docs[i], []string{"image"}, value)
+		if err != nil {
+			t.Fatalf("YAMLPath() of document %d error = %v", i, err)
+		}
+		edits = append(edits, edit)
+	}
+
+	got, err := Apply(content, edits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Apply() = %q, want %q", got, want)
+	}
+}
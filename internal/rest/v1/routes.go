@@ -1,13 +1,21 @@
 package v1
 
 import (
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 
+	gh "github.com/google/go-github/v42/github"
 	"github.com/labstack/echo/v4"
 	"github.com/paulfarver/valet/internal/github"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// defaultPerPage is the page size of listings, unless set with the per_page parameter
+const defaultPerPage = 30
+
 type Handler struct{}
 
 func Register(g *echo.Group, l *logrus.Logger, svc *github.Service) {
@@ -18,27 +26,69 @@ func Register(g *echo.Group, l *logrus.Logger, svc *github.Service) {
 	})
 
 	g.GET("/list", func(c echo.Context) error {
-		res, err := svc.ListInstallations(c.Request().Context())
+		page, err := queryInt(c, "page", 1)
+		if err != nil {
+			return c.String(400, err.Error())
+		}
+		perPage, err := queryInt(c, "per_page", defaultPerPage)
+		if err != nil {
+			return c.String(400, err.Error())
+		}
+
+		res, next, err := svc.ListInstallationsPage(c.Request().Context(), gh.ListOptions{Page: page, PerPage: perPage})
 		if err != nil {
 			l.WithError(err).Error("Failed to list installations")
 
 			return c.String(500, err.Error())
 		}
+		if next != 0 {
+			setNextLink(c, "page", strconv.Itoa(next))
+		}
 		return c.JSON(200, res)
 	})
 
 	g.GET("/repositories", func(c echo.Context) error {
-		res, err := svc.FullScan(c.Request().Context())
+		perPage, err := queryInt(c, "per_page", defaultPerPage)
+		if err != nil {
+			return c.String(400, err.Error())
+		}
+
+		res, next, err := svc.ListRepositoriesPage(c.Request().Context(), c.QueryParam("cursor"), perPage)
+		if errors.Cause(err) == github.ErrInvalidCursor {
+			return c.String(400, err.Error())
+		}
 		if err != nil {
 			l.WithError(err).Error("Failed to scan repositories")
 
 			return c.String(500, err.Error())
 		}
+		if next != "" {
+			setNextLink(c, "cursor", next)
+		}
 		return c.JSON(200, res)
 	})
 
 	g.POST("/webhook", func(c echo.Context) error {
-		err := svc.ScheduleImageUpdates(c.Request().Context(), l)
+		payload, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return c.String(400, err.Error())
+		}
+
+		// Finished checks may let valet merge its pull requests, every other event triggers a scan
+		switch event := parseEvent(c, payload).(type) {
+		case *gh.CheckSuiteEvent:
+			if event.GetAction() != "completed" {
+				return c.NoContent(http.StatusNoContent)
+			}
+			return mergeChecked(c, l, svc, event.GetInstallation(), event.GetRepo(), event.GetCheckSuite().GetHeadSHA())
+		case *gh.StatusEvent:
+			if event.GetState() != "success" {
+				return c.NoContent(http.StatusNoContent)
+			}
+			return mergeChecked(c, l, svc, event.GetInstallation(), event.GetRepo(), event.GetSHA())
+		}
+
+		err = svc.ScheduleImageUpdates(c.Request().Context(), l)
 		if err != nil {
 			l.WithError(err).Error("Failed to schedule image updates")
 
@@ -47,3 +97,44 @@ func Register(g *echo.Group, l *logrus.Logger, svc *github.Service) {
 		return c.NoContent(http.StatusAccepted)
 	})
 }
+
+// queryInt returns the positive integer query parameter, or def if it is absent
+func queryInt(c echo.Context, name string, def int) (int, error) {
+	str := c.QueryParam(name)
+	if str == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(str)
+	if err != nil || i < 1 {
+		return 0, errors.Errorf("Invalid %s %s", name, str)
+	}
+	return i, nil
+}
+
+// setNextLink sets a Link header pointing at the next page, which is the
+// request with the query parameter set to value
+func setNextLink(c echo.Context, param, value string) {
+	u := *c.Request().URL
+	query := u.Query()
+	query.Set(param, value)
+	u.RawQuery = query.Encode()
+	c.Response().Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, u.String()))
+}
+
+// parseEvent returns the webhook event of the request, or nil if it cannot be parsed
+func parseEvent(c echo.Context, payload []byte) interface{} {
+	event, err := gh.ParseWebHook(gh.WebHookType(c.Request()), payload)
+	if err != nil {
+		return nil
+	}
+	return event
+}
+
+func mergeChecked(c echo.Context, l *logrus.Logger, svc *github.Service, installation *gh.Installation, repo *gh.Repository, sha string) error {
+	if err := svc.MergeChecked(c.Request().Context(), installation.GetID(), repo, sha, l); err != nil {
+		l.WithError(err).Error("Failed to merge checked pull requests")
+
+		return c.String(500, err.Error())
+	}
+	return c.NoContent(http.StatusAccepted)
+}
@@ -0,0 +1,74 @@
+package updater
+
+import (
+	"strconv"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/paulfarver/valet/internal/chart"
+	"github.com/pkg/errors"
+)
+
+// NewArgoApplication bumps the helm chart sources of Argo CD Applications
+func NewArgoApplication(charts chart.Service) Updater {
+	return &chartUpdater{
+		charts: charts,
+		references: func(env *Env, doc *gabs.Container) ([]*ChartReference, error) {
+			return argoChartReferences(doc, "spec")
+		},
+	}
+}
+
+// NewArgoApplicationSet bumps the helm chart sources of the application
+// template of Argo CD ApplicationSets
+func NewArgoApplicationSet(charts chart.Service) Updater {
+	return &chartUpdater{
+		charts: charts,
+		references: func(env *Env, doc *gabs.Container) ([]*ChartReference, error) {
+			return argoChartReferences(doc, "spec", "template", "spec")
+		},
+	}
+}
+
+// argoChartReferences returns the helm chart sources of the Argo CD
+// application spec found at the given path. Both the single spec.source and
+// the multi-source spec.sources forms are supported, and sources that are not
+// helm charts (e.g. plain git paths) are skipped.
+func argoChartReferences(doc *gabs.Container, spec ...string) ([]*ChartReference, error) {
+	paths := [][]string{}
+	if doc.Exists(append(spec, "source")...) {
+		paths = append(paths, appendPath(spec, "source"))
+	}
+	sources, _ := doc.Search(append(spec, "sources")...).Data().([]interface{})
+	for i := range sources {
+		paths = append(paths, appendPath(spec, "sources", strconv.Itoa(i)))
+	}
+
+	refs := []*ChartReference{}
+	for _, path := range paths {
+		source := doc.Search(path...)
+		name, ok := source.Search("chart").Data().(string)
+		if !ok {
+			continue
+		}
+		repo, ok := source.Search("repoURL").Data().(string)
+		if !ok {
+			return nil, errors.Errorf("Failed to get repository of chart %s", name)
+		}
+		version, ok := source.Search("targetRevision").Data().(string)
+		if !ok {
+			return nil, errors.Errorf("Failed to get target revision of chart %s", name)
+		}
+		refs = append(refs, &ChartReference{
+			Name:        name,
+			Repository:  repo,
+			Version:     version,
+			VersionPath: append(path, "targetRevision"),
+		})
+	}
+
+	if len(refs) == 0 {
+		return nil, errors.New("No chart sources found")
+	}
+
+	return refs, nil
+}
@@ -0,0 +1,78 @@
+package updater
+
+import (
+	"context"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/Masterminds/semver/v3"
+	"github.com/paulfarver/valet/internal/chart"
+	"github.com/pkg/errors"
+)
+
+// ChartReference locates a chart and the field holding its version within a document
+type ChartReference struct {
+	Name        string
+	Repository  string
+	Version     string
+	VersionPath []string
+}
+
+// chartUpdater bumps the charts referenced by a document
+type chartUpdater struct {
+	charts     chart.Service
+	references func(env *Env, doc *gabs.Container) ([]*ChartReference, error)
+}
+
+func (u *chartUpdater) Update(ctx context.Context, env *Env, doc *gabs.Container) ([]Change, error) {
+	con, err := AnnotationFilter(doc, "chart")
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := u.references(env, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	for _, ref := range refs {
+		change, err := BumpChart(ctx, env, u.charts, ref, con)
+		if err != nil {
+			env.Log.WithError(err).Warnf("Failed to bump chart %s", ref.Name)
+			continue
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+
+	return changes, nil
+}
+
+// BumpChart returns the change that moves the referenced chart to the latest
+// available version allowed by the constraint, or nil if it is up to date
+func BumpChart(ctx context.Context, env *Env, charts chart.Service, ref *ChartReference, con *semver.Constraints) (*Change, error) {
+	oldV, err := semver.NewVersion(ref.Version)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse current version")
+	}
+
+	available, err := charts.ListVersions(ctx, ref.Repository, ref.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list available chart versions")
+	}
+
+	v := LatestVersion(env.Log, oldV, available, con)
+	if v.Equal(oldV) {
+		return nil, nil
+	}
+
+	return &Change{
+		Path:  ref.VersionPath,
+		Kind:  KindChart,
+		Name:  ref.Name,
+		Old:   ref.Version,
+		New:   v.Original(),
+		Value: v.Original(),
+	}, nil
+}
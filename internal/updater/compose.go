@@ -0,0 +1,98 @@
+package updater
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/Masterminds/semver/v3"
+	"github.com/paulfarver/valet/internal/image"
+	"github.com/pkg/errors"
+)
+
+// composeExtension is the compose extension field configuring a service
+const composeExtension = "x-valet"
+
+type compose struct {
+	images image.Service
+}
+
+// NewCompose bumps the images of the services in docker-compose files. Every
+// service with a tagged image is updated, and can be configured through an
+// x-valet extension field:
+//
+//	services:
+//	  web:
+//	    image: ghcr.io/example/web:1.2.3
+//	    x-valet:
+//	      filter: semver:~1.2
+//	      digest: pin
+//	  db:
+//	    image: postgres:14.1
+//	    x-valet:
+//	      ignore: true
+func NewCompose(images image.Service) Updater {
+	return &compose{
+		images: images,
+	}
+}
+
+func (c *compose) Update(ctx context.Context, env *Env, doc *gabs.Container) ([]Change, error) {
+	services := doc.Search("services").ChildrenMap()
+	if len(services) == 0 {
+		return nil, errors.New("No services found")
+	}
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	changes := []Change{}
+	for _, name := range names {
+		change, err := c.updateService(ctx, env, services[name], []string{"services", name})
+		if err != nil {
+			env.Log.WithError(err).Warnf("Failed to bump image of service %s", name)
+			continue
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+
+	return changes, nil
+}
+
+func (c *compose) updateService(ctx context.Context, env *Env, service *gabs.Container, path []string) (*Change, error) {
+	str, ok := service.Search("image").Data().(string)
+	if !ok {
+		// Services built from a Dockerfile have no image to bump
+		return nil, nil
+	}
+
+	if ignore, _ := service.Search(composeExtension, "ignore").Data().(bool); ignore {
+		return nil, nil
+	}
+
+	con, err := semver.NewConstraint(">=0.0.0")
+	if err != nil {
+		return nil, err
+	}
+	if filter, ok := service.Search(composeExtension, "filter").Data().(string); ok {
+		con, err = ParseFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mode := env.Digest
+	if digest, ok := service.Search(composeExtension, "digest").Data().(string); ok {
+		mode, err = ParseDigestMode(digest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return BumpImageReference(ctx, env, c.images, str, appendPath(path, "image"), con, mode)
+}
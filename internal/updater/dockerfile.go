@@ -0,0 +1,359 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/paulfarver/valet/internal/image"
+	"github.com/paulfarver/valet/internal/patch"
+	"github.com/pkg/errors"
+)
+
+var (
+	// argReference matches a value that is entirely a reference to an ARG
+	argReference = regexp.MustCompile(`^\$(?:\{(\w+)\}|(\w+))$`)
+	// argInTag matches a tag built from a single ARG and literal text around it
+	argInTag = regexp.MustCompile(`^([^$]*)\$(?:\{(\w+)\}|(\w+))([^$]*)$`)
+)
+
+// dockerToken is a word of an instruction and its byte offset in the file
+type dockerToken struct {
+	text   string
+	offset int
+}
+
+// dockerInstruction is a logical line of a Dockerfile, with continuation
+// lines joined and the marker of the comment preceding it, if any
+type dockerInstruction struct {
+	command string
+	args    []dockerToken
+	marker  *Marker
+}
+
+// dockerArg is the latest definition of an ARG with a default value
+type dockerArg struct {
+	value  dockerToken
+	marker *Marker
+}
+
+type dockerfile struct {
+	images image.Service
+}
+
+// NewDockerfile bumps the base images of Dockerfiles. FROM lines are updated
+// in every stage, including ones with flags such as --platform, and base
+// images given through an ARG have the default of the ARG bumped instead. A
+// marker comment on the line before a FROM or ARG sets the filter, and lets
+// an ARG that is not used in a FROM be tracked as the tag of an image:
+//
+//	# valet: {"image": "node", "filter": "semver:^16"}
+//	ARG NODE_VERSION=16.13.0
+//	FROM node:${NODE_VERSION}-alpine AS build
+func NewDockerfile(images image.Service) FileUpdater {
+	return &dockerfile{
+		images: images,
+	}
+}
+
+func (d *dockerfile) UpdateFile(ctx context.Context, env *Env, content []byte) ([]Change, error) {
+	instructions, err := parseDockerfile(content)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	// FROM lines only see the ARGs declared before the first FROM, ARGs of
+	// a stage are scoped to it
+	args := map[string]dockerArg{}
+	global := true
+	stages := map[string]bool{}
+	bumped := map[int]bool{}
+	// ARG values used by a FROM line are bumped through it, so that the
+	// literal text around the ARG in the tag narrows the available tags
+	fromArgs := map[int]bool{}
+	marked := []dockerArg{}
+	add := func(change *Change, err error, token dockerToken) {
+		if err != nil {
+			env.Log.WithError(err).Warnf("Failed to bump %s", token.text)
+			return
+		}
+		if change == nil || bumped[token.offset] {
+			return
+		}
+		bumped[token.offset] = true
+		changes = append(changes, *change)
+	}
+
+	for _, inst := range instructions {
+		switch inst.command {
+		case "ARG":
+			for _, arg := range inst.args {
+				name, value, ok := splitArg(arg)
+				if !ok {
+					continue
+				}
+				arg := dockerArg{value: value, marker: inst.marker}
+				if global {
+					args[name] = arg
+				}
+				if inst.marker != nil && inst.marker.Image != "" {
+					marked = append(marked, arg)
+				}
+			}
+		case "FROM":
+			global = false
+			from, alias := fromImage(inst.args)
+			if from == nil {
+				continue
+			}
+			if alias != "" {
+				stages[strings.ToLower(alias)] = true
+			}
+			if stages[strings.ToLower(from.text)] || from.text == "scratch" {
+				continue
+			}
+			change, token, err := d.bumpFrom(ctx, env, *from, inst.marker, args)
+			if token.offset != from.offset {
+				fromArgs[token.offset] = true
+			}
+			add(change, err, token)
+		}
+	}
+
+	for _, arg := range marked {
+		if fromArgs[arg.value.offset] {
+			continue
+		}
+		change, err := d.bumpTag(ctx, env, &ImageReference{
+			Repository: arg.marker.Image,
+			Tag:        arg.value.text,
+		}, arg.value, arg.marker)
+		add(change, err, arg.value)
+	}
+
+	return changes, nil
+}
+
+// bumpFrom bumps the image of a FROM line, or the ARG it is taken from
+func (d *dockerfile) bumpFrom(ctx context.Context, env *Env, from dockerToken, marker *Marker, args map[string]dockerArg) (*Change, dockerToken, error) {
+	if !strings.Contains(from.text, "$") {
+		change, err := d.bumpReference(ctx, env, from, marker)
+		return change, from, err
+	}
+
+	if name := argName(from.text); name != "" {
+		arg, ok := args[name]
+		if !ok {
+			return nil, from, errors.Errorf("ARG %s has no default", name)
+		}
+		if marker == nil {
+			marker = arg.marker
+		}
+		change, err := d.bumpReference(ctx, env, arg.value, marker)
+		return change, arg.value, err
+	}
+
+	ref, err := image.ParseReference(from.text)
+	if err != nil {
+		return nil, from, err
+	}
+	m := argInTag.FindStringSubmatch(ref.Tag)
+	if m == nil || strings.Contains(ref.Name(), "$") {
+		return nil, from, errors.Errorf("Unsupported variable substitution in %s", from.text)
+	}
+	arg, ok := args[m[2]+m[3]]
+	if !ok {
+		return nil, from, errors.Errorf("ARG %s has no default", m[2]+m[3])
+	}
+	if marker == nil {
+		marker = arg.marker
+	}
+	change, err := d.bumpTag(ctx, env, &ImageReference{
+		Repository: ref.Name(),
+		Tag:        arg.value.text,
+		Prefix:     m[1],
+		Suffix:     m[4],
+	}, arg.value, marker)
+	return change, arg.value, err
+}
+
+func (d *dockerfile) bumpReference(ctx context.Context, env *Env, token dockerToken, marker *Marker) (*Change, error) {
+	con, err := markerFilter(marker)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := markerDigest(env, marker)
+	if err != nil {
+		return nil, err
+	}
+	change, err := BumpImageReference(ctx, env, d.images, token.text, nil, con, mode)
+	if err != nil || change == nil {
+		return nil, err
+	}
+	change.Edit = &patch.Edit{Offset: token.offset, Length: len(token.text), Text: change.Value}
+	return change, nil
+}
+
+func (d *dockerfile) bumpTag(ctx context.Context, env *Env, ref *ImageReference, token dockerToken, marker *Marker) (*Change, error) {
+	con, err := markerFilter(marker)
+	if err != nil {
+		return nil, err
+	}
+	change, err := BumpImage(ctx, env, d.images, ref, con)
+	if err != nil || change == nil {
+		return nil, err
+	}
+	change.Edit = &patch.Edit{Offset: token.offset, Length: len(token.text), Text: change.Value}
+	return change, nil
+}
+
+func markerFilter(marker *Marker) (*semver.Constraints, error) {
+	if marker == nil || marker.Filter == "" {
+		return semver.NewConstraint(">=0.0.0")
+	}
+	return ParseFilter(marker.Filter)
+}
+
+// markerDigest returns the digest mode set by the marker, falling back to the
+// mode of the rule
+func markerDigest(env *Env, marker *Marker) (DigestMode, error) {
+	if marker == nil || marker.Digest == "" {
+		return env.Digest, nil
+	}
+	return ParseDigestMode(marker.Digest)
+}
+
+// argName returns the name of the ARG the value consists of, if any
+func argName(value string) string {
+	m := argReference.FindStringSubmatch(value)
+	if m == nil {
+		return ""
+	}
+	return m[1] + m[2]
+}
+
+// splitArg splits NAME=value, returning the value token without quotes
+func splitArg(arg dockerToken) (string, dockerToken, bool) {
+	i := strings.Index(arg.text, "=")
+	if i < 0 {
+		return "", dockerToken{}, false
+	}
+	value := dockerToken{text: arg.text[i+1:], offset: arg.offset + i + 1}
+	if len(value.text) >= 2 && (value.text[0] == '"' || value.text[0] == '\'') && value.text[len(value.text)-1] == value.text[0] {
+		value = dockerToken{text: value.text[1 : len(value.text)-1], offset: value.offset + 1}
+	}
+	return arg.text[:i], value, true
+}
+
+// fromImage returns the image and stage name of the arguments of a FROM
+func fromImage(args []dockerToken) (*dockerToken, string) {
+	i := 0
+	for i < len(args) && strings.HasPrefix(args[i].text, "--") {
+		i++
+	}
+	if i >= len(args) {
+		return nil, ""
+	}
+	from := args[i]
+	if i+2 < len(args) && strings.EqualFold(args[i+1].text, "AS") {
+		return &from, args[i+2].text
+	}
+	return &from, ""
+}
+
+// parseDockerfile splits a Dockerfile into instructions, keeping the offset
+// of every word so changes can be written back in place
+func parseDockerfile(content []byte) ([]dockerInstruction, error) {
+	instructions := []dockerInstruction{}
+	var current *dockerInstruction
+	var marker *Marker
+
+	offset := 0
+	for offset < len(content) {
+		end := bytes.IndexByte(content[offset:], '\n')
+		if end < 0 {
+			end = len(content)
+		} else {
+			end += offset
+		}
+		line := content[offset:end]
+		start := offset
+		offset = end + 1
+
+		trimmed := strings.TrimSpace(string(line))
+		if strings.HasPrefix(trimmed, "#") {
+			comment := strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+			if current == nil && strings.HasPrefix(comment, markerPrefix) {
+				var m Marker
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(comment, markerPrefix)), &m); err != nil {
+					return nil, errors.Wrapf(err, "Invalid marker %s", trimmed)
+				}
+				marker = &m
+			}
+			continue
+		}
+		if trimmed == "" {
+			if current == nil {
+				marker = nil
+			}
+			continue
+		}
+
+		continued := strings.HasSuffix(strings.TrimRight(string(line), " \t\r"), "\\")
+		tokens := tokenize(line, start)
+		if continued && len(tokens) > 0 {
+			last := &tokens[len(tokens)-1]
+			last.text = strings.TrimSuffix(last.text, "\\")
+			if last.text == "" {
+				tokens = tokens[:len(tokens)-1]
+			}
+		}
+
+		if current == nil {
+			if len(tokens) == 0 {
+				continue
+			}
+			current = &dockerInstruction{
+				command: strings.ToUpper(tokens[0].text),
+				args:    tokens[1:],
+				marker:  marker,
+			}
+			marker = nil
+		} else {
+			current.args = append(current.args, tokens...)
+		}
+
+		if !continued {
+			instructions = append(instructions, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		instructions = append(instructions, *current)
+	}
+
+	return instructions, nil
+}
+
+// tokenize splits a line into whitespace separated words
+func tokenize(line []byte, offset int) []dockerToken {
+	tokens := []dockerToken{}
+	start := -1
+	for i := 0; i <= len(line); i++ {
+		if i == len(line) || line[i] == ' ' || line[i] == '\t' || line[i] == '\r' {
+			if start >= 0 {
+				tokens = append(tokens, dockerToken{text: string(line[start:i]), offset: offset + start})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,324 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/paulfarver/valet/internal/patch"
+	"github.com/sirupsen/logrus"
+)
+
+func TestParseDockerfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []dockerInstruction
+		wantErr bool
+	}{
+		{
+			name:    "single stage",
+			content: "FROM node:16.13.0\nRUN npm ci\n",
+			want: []dockerInstruction{
+				{command: "FROM", args: []dockerToken{{"node:16.13.0", 5}}},
+				{command: "RUN", args: []dockerToken{{"npm", 22}, {"ci", 26}}},
+			},
+		},
+		{
+			name:    "lower case and flags",
+			content: "from --platform=$BUILDPLATFORM golang:1.17 AS build",
+			want: []dockerInstruction{
+				{command: "FROM", args: []dockerToken{{"--platform=$BUILDPLATFORM", 5}, {"golang:1.17", 31}, {"AS", 43}, {"build", 46}}},
+			},
+		},
+		{
+			name:    "indentation, tabs and carriage returns",
+			content: "  FROM\tnginx:1.20 \r\n",
+			want: []dockerInstruction{
+				{command: "FROM", args: []dockerToken{{"nginx:1.20", 7}}},
+			},
+		},
+		{
+			name:    "continuation lines",
+			content: "FROM \\\n  --platform=linux/amd64 \\\n  alpine:3.15\\\n  AS base\n",
+			want: []dockerInstruction{
+				{command: "FROM", args: []dockerToken{{"--platform=linux/amd64", 9}, {"alpine:3.15", 36}, {"AS", 51}, {"base", 54}}},
+			},
+		},
+		{
+			name:    "comments inside continuations",
+			content: "RUN apk add \\\n  # valet: {\"image\": \"curl\"}\n  curl\nFROM alpine:3.15\n",
+			want: []dockerInstruction{
+				{command: "RUN", args: []dockerToken{{"apk", 4}, {"add", 8}, {"curl", 45}}},
+				{command: "FROM", args: []dockerToken{{"alpine:3.15", 55}}},
+			},
+		},
+		{
+			name:    "marker",
+			content: "# valet: {\"image\": \"node\", \"filter\": \"semver:^16\"}\nARG NODE_VERSION=16.13.0\n",
+			want: []dockerInstruction{
+				{
+					command: "ARG",
+					args:    []dockerToken{{"NODE_VERSION=16.13.0", 55}},
+					marker:  &Marker{Image: "node", Filter: "semver:^16"},
+				},
+			},
+		},
+		{
+			name:    "marker after other comments",
+			content: "# valet: {\"digest\": \"pin\"}\n# base image\nFROM alpine:3.15\n",
+			want: []dockerInstruction{
+				{command: "FROM", args: []dockerToken{{"alpine:3.15", 45}}, marker: &Marker{Digest: "pin"}},
+			},
+		},
+		{
+			name:    "marker separated by a blank line",
+			content: "# valet: {\"digest\": \"pin\"}\n\nFROM alpine:3.15\n",
+			want: []dockerInstruction{
+				{command: "FROM", args: []dockerToken{{"alpine:3.15", 33}}},
+			},
+		},
+		{
+			name:    "no trailing newline",
+			content: "FROM scratch",
+			want: []dockerInstruction{
+				{command: "FROM", args: []dockerToken{{"scratch", 5}}},
+			},
+		},
+		{
+			name:    "unterminated continuation",
+			content: "FROM alpine:3.15 \\",
+			want: []dockerInstruction{
+				{command: "FROM", args: []dockerToken{{"alpine:3.15", 5}}},
+			},
+		},
+		{
+			name:    "invalid marker",
+			content: "# valet: {image}\nFROM alpine:3.15\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDockerfile([]byte(tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseDockerfile() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDockerfile() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDockerfile() = %+v, want %+v", got, tt.want)
+			}
+			for _, instruction := range got {
+				for _, arg := range instruction.args {
+					if source := tt.content[arg.offset : arg.offset+len(arg.text)]; source != arg.text {
+						t.Errorf("token %q at offset %d reads %q", arg.text, arg.offset, source)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSplitArg(t *testing.T) {
+	tests := []struct {
+		name      string
+		arg       dockerToken
+		wantName  string
+		wantValue dockerToken
+		wantOk    bool
+	}{
+		{
+			name:      "value",
+			arg:       dockerToken{"NODE_VERSION=16.13.0", 4},
+			wantName:  "NODE_VERSION",
+			wantValue: dockerToken{"16.13.0", 17},
+			wantOk:    true,
+		},
+		{
+			name:      "double quoted",
+			arg:       dockerToken{`TAG="1.20"`, 4},
+			wantName:  "TAG",
+			wantValue: dockerToken{"1.20", 9},
+			wantOk:    true,
+		},
+		{
+			name:      "single quoted",
+			arg:       dockerToken{`TAG='1.20'`, 4},
+			wantName:  "TAG",
+			wantValue: dockerToken{"1.20", 9},
+			wantOk:    true,
+		},
+		{
+			name:      "empty",
+			arg:       dockerToken{"TAG=", 4},
+			wantName:  "TAG",
+			wantValue: dockerToken{"", 8},
+			wantOk:    true,
+		},
+		{
+			name: "no default",
+			arg:  dockerToken{"TAG", 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, value, ok := splitArg(tt.arg)
+			if name != tt.wantName || value != tt.wantValue || ok != tt.wantOk {
+				t.Errorf("splitArg() = %q, %+v, %v, want %q, %+v, %v", name, value, ok, tt.wantName, tt.wantValue, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestFromImage(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []dockerToken
+		wantImage *dockerToken
+		wantStage string
+	}{
+		{
+			name:      "image",
+			args:      []dockerToken{{"alpine:3.15", 5}},
+			wantImage: &dockerToken{"alpine:3.15", 5},
+		},
+		{
+			name:      "stage",
+			args:      []dockerToken{{"golang:1.17", 5}, {"as", 17}, {"build", 20}},
+			wantImage: &dockerToken{"golang:1.17", 5},
+			wantStage: "build",
+		},
+		{
+			name:      "flags",
+			args:      []dockerToken{{"--platform=linux/amd64", 5}, {"golang:1.17", 28}, {"AS", 40}, {"build", 43}},
+			wantImage: &dockerToken{"golang:1.17", 28},
+			wantStage: "build",
+		},
+		{
+			name: "only flags",
+			args: []dockerToken{{"--platform=linux/amd64", 5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image, stage := fromImage(tt.args)
+			if !reflect.DeepEqual(image, tt.wantImage) || stage != tt.wantStage {
+				t.Errorf("fromImage() = %+v, %q, want %+v, %q", image, stage, tt.wantImage, tt.wantStage)
+			}
+		})
+	}
+}
+
+// imagesStub serves fixed tags per repository, and digests derived from them
+type imagesStub map[string][]string
+
+func (s imagesStub) ListTags(ctx context.Context, repository string) ([]string, error) {
+	tags, ok := s[repository]
+	if !ok {
+		return nil, fmt.Errorf("unknown repository %s", repository)
+	}
+	return tags, nil
+}
+
+func (s imagesStub) Digest(ctx context.Context, repository, tag string) (string, error) {
+	return "sha256:" + tag, nil
+}
+
+// applyChanges applies the edits of the changes to the content
+func applyChanges(t *testing.T, content string, changes []Change) string {
+	t.Helper()
+	edits := []patch.Edit{}
+	for _, change := range changes {
+		edits = append(edits, *change.Edit)
+	}
+	out, err := patch.Apply([]byte(content), edits)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	return string(out)
+}
+
+func TestDockerfileUpdateFile(t *testing.T) {
+	images := imagesStub{
+		"node":   {"14.0.0-alpine", "14.1.0-alpine", "16.13.0-alpine", "16.14.0-alpine", "17.0.0"},
+		"alpine": {"3.14", "3.15"},
+		"curl":   {"7.80.0", "7.81.0"},
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "from",
+			content: "FROM --platform=$BUILDPLATFORM alpine:3.14 AS base\nFROM base\n",
+			want:    "FROM --platform=$BUILDPLATFORM alpine:3.15 AS base\nFROM base\n",
+		},
+		{
+			name:    "global arg in tag",
+			content: "ARG NODE_VERSION=16.13.0\nFROM node:${NODE_VERSION}-alpine\n",
+			want:    "ARG NODE_VERSION=16.14.0\nFROM node:${NODE_VERSION}-alpine\n",
+		},
+		{
+			name: "arg redeclared in a stage",
+			content: "ARG NODE_VERSION=14.0.0\n" +
+				"FROM node:${NODE_VERSION}-alpine AS build\n" +
+				"ARG NODE_VERSION=16.13.0\n" +
+				"RUN echo $NODE_VERSION\n" +
+				"FROM node:${NODE_VERSION}-alpine\n",
+			want: "ARG NODE_VERSION=16.14.0\n" +
+				"FROM node:${NODE_VERSION}-alpine AS build\n" +
+				"ARG NODE_VERSION=16.13.0\n" +
+				"RUN echo $NODE_VERSION\n" +
+				"FROM node:${NODE_VERSION}-alpine\n",
+		},
+		{
+			name:    "arg declared in a stage only",
+			content: "FROM alpine:3.15\nARG TAG=3.14\nFROM alpine:${TAG}\n",
+			want:    "FROM alpine:3.15\nARG TAG=3.14\nFROM alpine:${TAG}\n",
+		},
+		{
+			name: "marked arg used by a from",
+			content: "# valet: {\"image\": \"node\", \"filter\": \"semver:^14\"}\n" +
+				"ARG NODE_VERSION=14.0.0\n" +
+				"FROM node:${NODE_VERSION}-alpine\n",
+			want: "# valet: {\"image\": \"node\", \"filter\": \"semver:^14\"}\n" +
+				"ARG NODE_VERSION=14.1.0\n" +
+				"FROM node:${NODE_VERSION}-alpine\n",
+		},
+		{
+			name: "marked arg in a stage",
+			content: "FROM alpine:3.15\n" +
+				"# valet: {\"image\": \"curl\"}\n" +
+				"ARG CURL_VERSION=7.80.0\n" +
+				"RUN apk add curl=$CURL_VERSION\n",
+			want: "FROM alpine:3.15\n" +
+				"# valet: {\"image\": \"curl\"}\n" +
+				"ARG CURL_VERSION=7.81.0\n" +
+				"RUN apk add curl=$CURL_VERSION\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &Env{Log: logrus.New()}
+			changes, err := NewDockerfile(images).UpdateFile(context.Background(), env, []byte(tt.content))
+			if err != nil {
+				t.Fatalf("UpdateFile() error = %v", err)
+			}
+			if got := applyChanges(t, tt.content, changes); got != tt.want {
+				t.Errorf("UpdateFile() applied = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
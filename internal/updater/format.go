@@ -0,0 +1,38 @@
+package updater
+
+import (
+	"bytes"
+	"path"
+	"strings"
+)
+
+const (
+	FormatYAML       = "yaml"
+	FormatJSON       = "json"
+	FormatDockerfile = "dockerfile"
+	FormatHCL        = "hcl"
+)
+
+// DetectFormat guesses the format of a file from its name, falling back to
+// its content for JSON files without a .json extension. Files that are not
+// recognized are assumed to be YAML.
+func DetectFormat(file string, content []byte) string {
+	base := path.Base(file)
+	if base == "Dockerfile" || strings.HasPrefix(base, "Dockerfile.") || strings.HasSuffix(base, ".Dockerfile") || strings.HasSuffix(base, ".dockerfile") {
+		return FormatDockerfile
+	}
+	switch path.Ext(base) {
+	case ".tf":
+		return FormatHCL
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return FormatJSON
+	}
+	return FormatYAML
+}
@@ -0,0 +1,75 @@
+package updater
+
+import (
+	"github.com/Jeffail/gabs/v2"
+	"github.com/paulfarver/valet/internal/chart"
+	"github.com/pkg/errors"
+)
+
+// GenericConfig describes where the charts of a custom resource are declared,
+// so resources valet has no built in support for can be updated
+type GenericConfig struct {
+	APIVersion string               `yaml:"apiVersion"`
+	Kind       string               `yaml:"kind"`
+	Charts     []GenericChartConfig `yaml:"charts"`
+}
+
+// GenericChartConfig holds the paths of the chart fields, given either as
+// dot separated paths or JSON pointers
+type GenericChartConfig struct {
+	Name       string `yaml:"name"`
+	Repository string `yaml:"repository"`
+	Version    string `yaml:"version"`
+}
+
+func (c GenericConfig) Validate() error {
+	if c.APIVersion == "" || c.Kind == "" {
+		return errors.New("Updater must specify apiVersion and kind")
+	}
+	if len(c.Charts) == 0 {
+		return errors.Errorf("Updater for %s must specify charts", c.Kind)
+	}
+	for _, ch := range c.Charts {
+		for _, p := range []string{ch.Name, ch.Repository, ch.Version} {
+			if _, err := ParsePath(p); err != nil {
+				return errors.Wrapf(err, "Chart of updater for %s must specify name, repository and version paths", c.Kind)
+			}
+		}
+	}
+	return nil
+}
+
+// NewGeneric bumps the charts found at the configured paths
+func NewGeneric(charts chart.Service, conf GenericConfig) Updater {
+	return &chartUpdater{
+		charts: charts,
+		references: func(env *Env, doc *gabs.Container) ([]*ChartReference, error) {
+			refs := []*ChartReference{}
+			for _, c := range conf.Charts {
+				namePath, _ := ParsePath(c.Name)
+				repoPath, _ := ParsePath(c.Repository)
+				versionPath, _ := ParsePath(c.Version)
+
+				name, ok := doc.Search(namePath...).Data().(string)
+				if !ok {
+					return nil, errors.Errorf("Failed to get chart name at %s", c.Name)
+				}
+				repo, ok := doc.Search(repoPath...).Data().(string)
+				if !ok {
+					return nil, errors.Errorf("Failed to get chart repository at %s", c.Repository)
+				}
+				version, ok := doc.Search(versionPath...).Data().(string)
+				if !ok {
+					return nil, errors.Errorf("Failed to get chart version at %s", c.Version)
+				}
+				refs = append(refs, &ChartReference{
+					Name:        name,
+					Repository:  repo,
+					Version:     version,
+					VersionPath: versionPath,
+				})
+			}
+			return refs, nil
+		},
+	}
+}
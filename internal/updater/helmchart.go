@@ -0,0 +1,219 @@
+package updater
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/Masterminds/semver/v3"
+	"github.com/paulfarver/valet/internal/chart"
+	"github.com/paulfarver/valet/internal/patch"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// bumpChartVersionAnnotation makes the umbrella chart's own version be bumped
+// along with its dependencies
+const bumpChartVersionAnnotation = "valet.io/bump-chart-version"
+
+// Locker is implemented by updaters whose files have a lock file that must be
+// regenerated and committed together with the updated file
+type Locker interface {
+	// LockFile returns the path of the lock file belonging to the file
+	LockFile(file string) string
+	// UpdateLock returns the lock file regenerated for the updated file content
+	UpdateLock(ctx context.Context, env *Env, content, lock []byte) ([]byte, error)
+}
+
+type helmChart struct {
+	charts chart.Service
+}
+
+// NewHelmChart bumps the dependencies declared in the Chart.yaml of an
+// umbrella chart and regenerates its Chart.lock. Filters are set with
+// filter.valet.io/<dependency> entries in the annotations of the chart.
+func NewHelmChart(charts chart.Service) Updater {
+	return &helmChart{
+		charts: charts,
+	}
+}
+
+func (h *helmChart) Update(ctx context.Context, env *Env, doc *gabs.Container) ([]Change, error) {
+	if doc.Search("apiVersion").Data() != "v2" || !doc.Exists("name") {
+		return nil, errors.New("Document is not a v2 Chart.yaml")
+	}
+
+	changes := []Change{}
+	for i, dep := range doc.Search("dependencies").Children() {
+		change, err := h.updateDependency(ctx, env, doc, dep, []string{"dependencies", strconv.Itoa(i), "version"})
+		if err != nil {
+			env.Log.WithError(err).Warnf("Failed to bump dependency %v", dep.Search("name").Data())
+			continue
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+
+	if len(changes) > 0 && doc.Search("annotations", bumpChartVersionAnnotation).Data() == "true" {
+		change, err := bumpChartVersion(doc)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, *change)
+	}
+
+	return changes, nil
+}
+
+func (h *helmChart) updateDependency(ctx context.Context, env *Env, doc, dep *gabs.Container, versionPath []string) (*Change, error) {
+	name, ok := dep.Search("name").Data().(string)
+	if !ok {
+		return nil, errors.New("Failed to get dependency name")
+	}
+	repo, _ := dep.Search("repository").Data().(string)
+	if repo == "" || strings.HasPrefix(repo, "file://") || strings.HasPrefix(repo, "@") || strings.HasPrefix(repo, "alias:") {
+		// Local charts and repositories referenced by a local helm repo name can't be resolved
+		return nil, nil
+	}
+	version, ok := dep.Search("version").Data().(string)
+	if !ok {
+		return nil, errors.Errorf("Failed to get version of dependency %s", name)
+	}
+
+	con, err := semver.NewConstraint(">=0.0.0")
+	if err != nil {
+		return nil, err
+	}
+	if filter, ok := doc.Search("annotations", filterAnnotationPrefix+name).Data().(string); ok {
+		con, err = ParseFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return BumpChart(ctx, env, h.charts, &ChartReference{
+		Name:        name,
+		Repository:  repo,
+		Version:     version,
+		VersionPath: versionPath,
+	}, con)
+}
+
+func bumpChartVersion(doc *gabs.Container) (*Change, error) {
+	str, ok := doc.Search("version").Data().(string)
+	if !ok {
+		return nil, errors.New("Failed to get chart version")
+	}
+	v, err := semver.NewVersion(str)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse chart version")
+	}
+	next := v.IncPatch()
+	name, _ := doc.Search("name").Data().(string)
+
+	return &Change{
+		Path:  []string{"version"},
+		Kind:  KindChart,
+		Name:  name,
+		Old:   str,
+		New:   next.Original(),
+		Value: next.Original(),
+	}, nil
+}
+
+func (h *helmChart) LockFile(file string) string {
+	return path.Join(path.Dir(file), "Chart.lock")
+}
+
+// chartDependency mirrors the dependency type of helm, which determines the
+// JSON the lock digest is computed from
+type chartDependency struct {
+	Name         string        `json:"name" yaml:"name"`
+	Version      string        `json:"version,omitempty" yaml:"version,omitempty"`
+	Repository   string        `json:"repository" yaml:"repository"`
+	Condition    string        `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Tags         []string      `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Enabled      bool          `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	ImportValues []interface{} `json:"import-values,omitempty" yaml:"import-values,omitempty"`
+	Alias        string        `json:"alias,omitempty" yaml:"alias,omitempty"`
+}
+
+// UpdateLock moves the locked dependencies to the versions pinned in the
+// updated Chart.yaml, and recomputes the digest and generated timestamp the
+// same way helm dependency update does
+func (h *helmChart) UpdateLock(ctx context.Context, env *Env, content, lock []byte) ([]byte, error) {
+	var metadata struct {
+		Dependencies []*chartDependency `yaml:"dependencies"`
+	}
+	if err := yaml.Unmarshal(content, &metadata); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode Chart.yaml")
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(lock, &node); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode Chart.lock")
+	}
+	var locked struct {
+		Dependencies []*chartDependency `yaml:"dependencies"`
+	}
+	if err := node.Decode(&locked); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode Chart.lock")
+	}
+
+	edits := []patch.Edit{}
+	for i, l := range locked.Dependencies {
+		for _, req := range metadata.Dependencies {
+			if req.Name != l.Name || req.Repository != l.Repository {
+				continue
+			}
+			// Only pinned versions can be carried over, ranges need a full resolve by helm
+			if _, err := semver.NewVersion(req.Version); err != nil || req.Version == l.Version {
+				continue
+			}
+			edit, err := patch.YAMLPath(lock, &node, []string{"dependencies", strconv.Itoa(i), "version"}, req.Version)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, edit)
+			l.Version = req.Version
+		}
+	}
+
+	digest, err := hashRequirements(metadata.Dependencies, locked.Dependencies)
+	if err != nil {
+		return nil, err
+	}
+	// An unchanged lock keeps its generation time, so it is not committed again
+	if current, err := patch.Lookup(&node, []string{"digest"}); err == nil && len(edits) == 0 && current.Value == digest {
+		return lock, nil
+	}
+	edit, err := patch.YAMLPath(lock, &node, []string{"digest"}, digest)
+	if err != nil {
+		return nil, err
+	}
+	edits = append(edits, edit)
+
+	edit, err = patch.YAMLPath(lock, &node, []string{"generated"}, time.Now().Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, err
+	}
+	edits = append(edits, edit)
+
+	return patch.Apply(lock, edits)
+}
+
+// hashRequirements computes the Chart.lock digest like helm's resolver.HashReq
+func hashRequirements(req, lock []*chartDependency) (string, error) {
+	data, err := json.Marshal([2][]*chartDependency{req, lock})
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to encode dependencies")
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data)), nil
+}
@@ -0,0 +1,51 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUpdateLock(t *testing.T) {
+	chartYAML := func(version string) []byte {
+		return []byte(fmt.Sprintf("apiVersion: v2\nname: app\nversion: 1.0.0\ndependencies:\n  - name: redis\n    version: %s\n    repository: https://charts.bitnami.com/bitnami\n", version))
+	}
+	dependency := func(version string) []*chartDependency {
+		return []*chartDependency{{Name: "redis", Version: version, Repository: "https://charts.bitnami.com/bitnami"}}
+	}
+	digest, err := hashRequirements(dependency("16.4.0"), dependency("16.4.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := []byte(fmt.Sprintf("dependencies:\n- name: redis\n  repository: https://charts.bitnami.com/bitnami\n  version: 16.4.0\ndigest: %s\ngenerated: \"2022-02-01T10:00:00.000000+01:00\"\n", digest))
+
+	t.Run("unchanged", func(t *testing.T) {
+		got, err := (&helmChart{}).UpdateLock(context.Background(), nil, chartYAML("16.4.0"), lock)
+		if err != nil {
+			t.Fatalf("UpdateLock() error = %v", err)
+		}
+		if string(got) != string(lock) {
+			t.Errorf("UpdateLock() = %q, want %q", got, lock)
+		}
+	})
+
+	t.Run("bumped", func(t *testing.T) {
+		got, err := (&helmChart{}).UpdateLock(context.Background(), nil, chartYAML("16.5.0"), lock)
+		if err != nil {
+			t.Fatalf("UpdateLock() error = %v", err)
+		}
+		want, err := hashRequirements(dependency("16.5.0"), dependency("16.5.0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []string{"  version: 16.5.0\n", "digest: " + want + "\n"} {
+			if !strings.Contains(string(got), s) {
+				t.Errorf("UpdateLock() = %q, want it to contain %q", got, s)
+			}
+		}
+		if strings.Contains(string(got), "2022-02-01") {
+			t.Errorf("UpdateLock() = %q, want a new generation time", got)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package updater
+
+import (
+	"context"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/Masterminds/semver/v3"
+	"github.com/paulfarver/valet/internal/chart"
+	"github.com/paulfarver/valet/internal/image"
+	"github.com/pkg/errors"
+)
+
+// helmRelease bumps the chart of a HelmRelease, and the images in its
+// spec.values if the release has the valet.io/values-images annotation
+type helmRelease struct {
+	chartUpdater
+	values *ValuesImages
+}
+
+// NewHelmReleaseV1 bumps Flux v1 HelmReleases, which carry the chart
+// repository inline in spec.chart
+func NewHelmReleaseV1(charts chart.Service, images image.Service) Updater {
+	return &helmRelease{
+		chartUpdater: chartUpdater{
+			charts:     charts,
+			references: helmReleaseV1References,
+		},
+		values: NewValuesImages(images),
+	}
+}
+
+// NewHelmReleaseV2 bumps Flux v2 HelmReleases, whose chart repository is
+// resolved through the sourceRef to a HelmRepository or OCIRepository
+func NewHelmReleaseV2(charts chart.Service, images image.Service) Updater {
+	return &helmRelease{
+		chartUpdater: chartUpdater{
+			charts:     charts,
+			references: helmReleaseV2References,
+		},
+		values: NewValuesImages(images),
+	}
+}
+
+func (h *helmRelease) Update(ctx context.Context, env *Env, doc *gabs.Container) ([]Change, error) {
+	changes, err := h.chartUpdater.Update(ctx, env, doc)
+	if doc.Search("metadata", "annotations", valuesImagesAnnotation).Data() != "true" {
+		return changes, err
+	}
+	if err != nil {
+		// Images of the values are bumped even if the chart cannot be, e.g.
+		// when its source is outside of the files matched by the rule
+		env.Log.WithError(err).Warn("Failed to bump chart of release")
+	}
+
+	mode, err := AnnotationDigest(env, doc)
+	if err != nil {
+		env.Log.WithError(err).Warn("Failed to bump images of release values")
+		return changes, nil
+	}
+	changes = append(changes, h.values.Bump(ctx, env, doc, []string{"spec", "values"}, mode, func(name string) (*semver.Constraints, error) {
+		return AnnotationFilter(doc, name)
+	})...)
+
+	return changes, nil
+}
+
+func helmReleaseV1References(env *Env, doc *gabs.Container) ([]*ChartReference, error) {
+	name, ok := doc.Search("spec", "chart", "name").Data().(string)
+	if !ok {
+		return nil, errors.New("Failed to get chart name")
+	}
+	repo, ok := doc.Search("spec", "chart", "repository").Data().(string)
+	if !ok {
+		return nil, errors.New("Failed to get chart repository")
+	}
+	version, ok := doc.Search("spec", "chart", "version").Data().(string)
+	if !ok {
+		return nil, errors.New("Failed to get chart version")
+	}
+
+	return []*ChartReference{{
+		Name:        name,
+		Repository:  repo,
+		Version:     version,
+		VersionPath: []string{"spec", "chart", "version"},
+	}}, nil
+}
+
+func helmReleaseV2References(env *Env, doc *gabs.Container) ([]*ChartReference, error) {
+	name, ok := doc.Search("spec", "chart", "spec", "chart").Data().(string)
+	if !ok {
+		return nil, errors.New("Failed to get chart name")
+	}
+	version, ok := doc.Search("spec", "chart", "spec", "version").Data().(string)
+	if !ok {
+		return nil, errors.New("Failed to get chart version")
+	}
+
+	kind, _ := doc.Search("spec", "chart", "spec", "sourceRef", "kind").Data().(string)
+	sourceName, ok := doc.Search("spec", "chart", "spec", "sourceRef", "name").Data().(string)
+	if !ok {
+		return nil, errors.New("Failed to get chart source name")
+	}
+	namespace, ok := doc.Search("spec", "chart", "spec", "sourceRef", "namespace").Data().(string)
+	if !ok {
+		// The source defaults to the namespace of the release
+		namespace, _ = doc.Search("metadata", "namespace").Data().(string)
+	}
+
+	repo, err := env.Sources.Resolve(kind, namespace, sourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*ChartReference{{
+		Name:        name,
+		Repository:  repo,
+		Version:     version,
+		VersionPath: []string{"spec", "chart", "spec", "version"},
+	}}, nil
+}
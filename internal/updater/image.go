@@ -0,0 +1,166 @@
+package updater
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/Masterminds/semver/v3"
+	"github.com/paulfarver/valet/internal/image"
+	"github.com/pkg/errors"
+)
+
+// ImageReference locates an image and the field holding its tag within a
+// document. If the field only holds part of the tag, as in an ARG used as
+// node:${VERSION}-alpine, Prefix and Suffix are the literal parts around it
+// and only tags with the same prefix and suffix are considered.
+type ImageReference struct {
+	Repository string
+	Tag        string
+	TagPath    []string
+	Prefix     string
+	Suffix     string
+}
+
+// DigestMode controls how image references are pinned by digest
+type DigestMode string
+
+const (
+	// DigestKeep moves the digest of a pinned reference along when its tag is
+	// bumped, and leaves references without a digest unpinned
+	DigestKeep DigestMode = ""
+	// DigestPin pins every reference to the digest of its tag, adding the
+	// digest to references without one
+	DigestPin DigestMode = "pin"
+	// DigestRefresh keeps the tag of pinned references and updates their
+	// digest whenever the tag points at a new one, as when a floating tag
+	// such as 1.4 or latest is pushed again
+	DigestRefresh DigestMode = "refresh"
+)
+
+// digestAnnotation sets the digest mode of the images in a document
+const digestAnnotation = "valet.io/digest"
+
+// ParseDigestMode parses a digest mode, where the empty string keeps digests
+func ParseDigestMode(str string) (DigestMode, error) {
+	switch mode := DigestMode(str); mode {
+	case DigestKeep, DigestPin, DigestRefresh:
+		return mode, nil
+	default:
+		return "", errors.Errorf("Unknown digest mode %s", str)
+	}
+}
+
+// AnnotationDigest returns the digest mode set by the valet.io/digest
+// annotation of the document, falling back to the mode of the rule
+func AnnotationDigest(env *Env, doc *gabs.Container) (DigestMode, error) {
+	value := doc.Search("metadata", "annotations", digestAnnotation)
+	if value == nil {
+		return env.Digest, nil
+	}
+
+	str, ok := value.Data().(string)
+	if !ok {
+		return "", errors.New("Invalid digest mode type")
+	}
+
+	return ParseDigestMode(str)
+}
+
+// BumpImage returns the change that moves the referenced image to the latest
+// available tag allowed by the constraint, or nil if it is up to date
+func BumpImage(ctx context.Context, env *Env, images image.Service, ref *ImageReference, con *semver.Constraints) (*Change, error) {
+	oldV, err := semver.NewVersion(ref.Tag)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse current tag")
+	}
+
+	tags, err := images.ListTags(ctx, ref.Repository)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list available image tags")
+	}
+
+	available := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if len(tag) > len(ref.Prefix)+len(ref.Suffix) && strings.HasPrefix(tag, ref.Prefix) && strings.HasSuffix(tag, ref.Suffix) {
+			available = append(available, tag[len(ref.Prefix):len(tag)-len(ref.Suffix)])
+		}
+	}
+
+	v := LatestVersion(env.Log, oldV, available, con)
+	if v.Equal(oldV) {
+		return nil, nil
+	}
+
+	return &Change{
+		Path:  ref.TagPath,
+		Kind:  KindImage,
+		Name:  ref.Repository,
+		Old:   ref.Tag,
+		New:   v.Original(),
+		Value: v.Original(),
+	}, nil
+}
+
+// BumpImageReference returns the change that moves the tag of a full image
+// reference, such as registry/repository:tag, to the latest available tag.
+// How the digest of the reference is handled depends on the digest mode.
+// References without a tag are left alone.
+func BumpImageReference(ctx context.Context, env *Env, images image.Service, str string, path []string, con *semver.Constraints, mode DigestMode) (*Change, error) {
+	ref, err := image.ParseReference(str)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Tag == "" {
+		return nil, nil
+	}
+
+	// Tags that are not versions, such as latest, cannot be bumped, and the
+	// tags of refreshed references float, so only their digest is updated
+	var change *Change
+	if _, err := semver.NewVersion(ref.Tag); err == nil && mode != DigestRefresh {
+		change, err = BumpImage(ctx, env, images, &ImageReference{
+			Repository: ref.Name(),
+			Tag:        ref.Tag,
+			TagPath:    path,
+		}, con)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tag := ref.Tag
+	if change != nil {
+		tag = change.New
+	}
+
+	digest := ref.Digest
+	if mode == DigestPin || (ref.Digest != "" && (change != nil || mode == DigestRefresh)) {
+		digest, err = images.Digest(ctx, ref.Name(), tag)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to resolve digest of %s:%s", ref.Name(), tag)
+		}
+	}
+
+	if change == nil {
+		if digest == ref.Digest {
+			return nil, nil
+		}
+		// Only the digest changed, so the change is described by tag and digest
+		old := ref.String()
+		ref.Digest = digest
+		change = &Change{
+			Path: path,
+			Kind: KindImage,
+			Name: ref.Name(),
+			Old:  strings.TrimPrefix(old, ref.Name()+":"),
+			New:  strings.TrimPrefix(ref.String(), ref.Name()+":"),
+		}
+	}
+
+	ref.Tag = tag
+	ref.Digest = digest
+	change.Value = ref.String()
+
+	return change, nil
+}
@@ -0,0 +1,47 @@
+package updater
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+// Item is an object within a document and its path from the document root
+type Item struct {
+	Path []string
+	Doc  *gabs.Container
+}
+
+// Items returns the objects contained in a document, so each can be updated
+// independently. Top-level sequences and the items of List kinds, such as
+// List or DeploymentList, are descended into recursively. Any other document
+// is an item by itself.
+func Items(doc *gabs.Container) []Item {
+	items := []Item{}
+	collectItems(doc, []string{}, &items)
+	return items
+}
+
+func collectItems(doc *gabs.Container, path []string, items *[]Item) {
+	if arr, ok := doc.Data().([]interface{}); ok {
+		for i := range arr {
+			collectItems(doc.Index(i), appendPath(path, strconv.Itoa(i)), items)
+		}
+		return
+	}
+
+	if kind, _ := doc.Search("kind").Data().(string); strings.HasSuffix(kind, "List") {
+		if list, ok := doc.Search("items").Data().([]interface{}); ok {
+			for i := range list {
+				collectItems(doc.Search("items", strconv.Itoa(i)), appendPath(path, "items", strconv.Itoa(i)), items)
+			}
+			return
+		}
+	}
+
+	*items = append(*items, Item{
+		Path: path,
+		Doc:  doc,
+	})
+}
@@ -0,0 +1,149 @@
+package updater
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/Masterminds/semver/v3"
+	"github.com/paulfarver/valet/internal/chart"
+	"github.com/paulfarver/valet/internal/image"
+	"github.com/pkg/errors"
+)
+
+type kustomize struct {
+	charts chart.Service
+	images image.Service
+}
+
+// NewKustomize bumps the images and helm charts pinned in kustomization.yaml
+// files. Kustomizations carry no annotations, so this updater is opted into by
+// naming it in a rule. Filters can still be set with filter.valet.io/<name>
+// annotations in the optional metadata of the kustomization, keyed by the
+// image or chart name.
+func NewKustomize(charts chart.Service, images image.Service) Updater {
+	return &kustomize{
+		charts: charts,
+		images: images,
+	}
+}
+
+func (k *kustomize) Update(ctx context.Context, env *Env, doc *gabs.Container) ([]Change, error) {
+	changes := []Change{}
+
+	for i, entry := range doc.Search("images").Children() {
+		cs, err := k.updateImage(ctx, env, doc, entry, []string{"images", strconv.Itoa(i)})
+		if err != nil {
+			env.Log.WithError(err).Warnf("Failed to bump image %v", entry.Search("name").Data())
+			continue
+		}
+		changes = append(changes, cs...)
+	}
+
+	for i, entry := range doc.Search("helmCharts").Children() {
+		change, err := k.updateChart(ctx, env, doc, entry, []string{"helmCharts", strconv.Itoa(i)})
+		if err != nil {
+			env.Log.WithError(err).Warnf("Failed to bump chart %v", entry.Search("name").Data())
+			continue
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+
+	return changes, nil
+}
+
+// updateImage bumps the newTag of an images entry. If the entry also pins a
+// digest, the digest is moved along to the one of the new tag, or refreshed
+// in the pin digest mode. The refresh mode keeps the tag and only refreshes
+// the digest. Entries without a digest field are not pinned, as the field
+// cannot be added in place.
+func (k *kustomize) updateImage(ctx context.Context, env *Env, doc, entry *gabs.Container, path []string) ([]Change, error) {
+	name, ok := entry.Search("name").Data().(string)
+	if !ok {
+		return nil, errors.New("Failed to get image name")
+	}
+	tag, ok := entry.Search("newTag").Data().(string)
+	if !ok {
+		// Entries that only rename an image or pin a digest have nothing to bump
+		return nil, nil
+	}
+	repository := name
+	if newName, ok := entry.Search("newName").Data().(string); ok {
+		repository = newName
+	}
+
+	con, err := AnnotationFilter(doc, name)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := AnnotationDigest(env, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	if _, err := semver.NewVersion(tag); err == nil && mode != DigestRefresh {
+		change, err := BumpImage(ctx, env, k.images, &ImageReference{
+			Repository: repository,
+			Tag:        tag,
+			TagPath:    appendPath(path, "newTag"),
+		}, con)
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			changes = append(changes, *change)
+			tag = change.New
+		}
+	}
+
+	oldDigest, ok := entry.Search("digest").Data().(string)
+	if !ok || (len(changes) == 0 && mode == DigestKeep) {
+		return changes, nil
+	}
+	digest, err := k.images.Digest(ctx, repository, tag)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to resolve digest of %s:%s", repository, tag)
+	}
+	if digest != oldDigest {
+		changes = append(changes, Change{
+			Path:  appendPath(path, "digest"),
+			Kind:  KindImage,
+			Name:  repository,
+			Old:   oldDigest,
+			New:   digest,
+			Value: digest,
+		})
+	}
+
+	return changes, nil
+}
+
+func (k *kustomize) updateChart(ctx context.Context, env *Env, doc, entry *gabs.Container, path []string) (*Change, error) {
+	name, ok := entry.Search("name").Data().(string)
+	if !ok {
+		return nil, errors.New("Failed to get chart name")
+	}
+	repo, ok := entry.Search("repo").Data().(string)
+	if !ok {
+		return nil, errors.Errorf("Failed to get repository of chart %s", name)
+	}
+	version, ok := entry.Search("version").Data().(string)
+	if !ok {
+		return nil, errors.Errorf("Failed to get version of chart %s", name)
+	}
+
+	con, err := AnnotationFilter(doc, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return BumpChart(ctx, env, k.charts, &ChartReference{
+		Name:        name,
+		Repository:  repo,
+		Version:     version,
+		VersionPath: appendPath(path, "version"),
+	}, con)
+}
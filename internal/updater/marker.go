@@ -0,0 +1,198 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/Masterminds/semver/v3"
+	"github.com/paulfarver/valet/internal/chart"
+	"github.com/paulfarver/valet/internal/image"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const markerPrefix = "valet:"
+
+// Marker is the setting of a line comment that opts a scalar into updates,
+// such as
+//
+//	version: 1.2.3 # valet: {"chart": "https://charts.example.com/podinfo", "filter": "semver:~1.2"}
+//	tag: 1.0.0 # valet: {"image": "ghcr.io/example/app"}
+//
+// A chart is given as its repository followed by the chart name. For images
+// the scalar may hold either the tag alone or a full image reference, and a
+// full reference can set a digest mode such as "digest": "pin".
+type Marker struct {
+	Chart  string `json:"chart"`
+	Image  string `json:"image"`
+	Filter string `json:"filter"`
+	Digest string `json:"digest"`
+}
+
+// MarkedField is a scalar with a marker comment
+type MarkedField struct {
+	Path   []string
+	Value  string
+	Marker Marker
+}
+
+// FindMarkers returns every scalar of the document that carries a marker comment
+func FindMarkers(node *yaml.Node) ([]MarkedField, error) {
+	fields := []MarkedField{}
+	err := findMarkers(node, []string{}, &fields)
+	return fields, err
+}
+
+func findMarkers(node *yaml.Node, path []string, fields *[]MarkedField) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			if err := findMarkers(n, path, fields); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			p := appendPath(path, node.Content[i].Value)
+			if err := findMarkers(node.Content[i+1], p, fields); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, n := range node.Content {
+			p := appendPath(path, strconv.Itoa(i))
+			if err := findMarkers(n, p, fields); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		comment := strings.TrimSpace(strings.TrimPrefix(node.LineComment, "#"))
+		if !strings.HasPrefix(comment, markerPrefix) {
+			return nil
+		}
+		var marker Marker
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(comment, markerPrefix)), &marker); err != nil {
+			return errors.Wrapf(err, "Invalid marker on line %d", node.Line)
+		}
+		*fields = append(*fields, MarkedField{
+			Path:   path,
+			Value:  node.Value,
+			Marker: marker,
+		})
+	}
+	return nil
+}
+
+// Markers bumps the fields opted into updates by marker comments
+type Markers struct {
+	charts chart.Service
+	images image.Service
+}
+
+func NewMarkers(charts chart.Service, images image.Service) *Markers {
+	return &Markers{
+		charts: charts,
+		images: images,
+	}
+}
+
+func (m *Markers) Update(ctx context.Context, env *Env, node *yaml.Node) ([]Change, error) {
+	fields, err := FindMarkers(node)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	for _, field := range fields {
+		change, err := m.updateField(ctx, env, field)
+		if err != nil {
+			env.Log.WithError(err).Warnf("Failed to bump marked field %s", strings.Join(field.Path, "."))
+			continue
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+
+	return changes, nil
+}
+
+// UpdateFields bumps the fields of the document configured in a rule. Fields
+// that are missing from the document are skipped.
+func (m *Markers) UpdateFields(ctx context.Context, env *Env, doc *gabs.Container, configs []FieldConfig) []Change {
+	changes := []Change{}
+	for _, c := range configs {
+		path, err := ParsePath(c.Path)
+		if err != nil {
+			env.Log.WithError(err).Warnf("Invalid field path %s", c.Path)
+			continue
+		}
+		value, ok := doc.Search(path...).Data().(string)
+		if !ok {
+			continue
+		}
+		change, err := m.updateField(ctx, env, MarkedField{
+			Path:  path,
+			Value: value,
+			Marker: Marker{
+				Chart:  c.Chart,
+				Image:  c.Image,
+				Filter: c.Filter,
+				Digest: c.Digest,
+			},
+		})
+		if err != nil {
+			env.Log.WithError(err).Warnf("Failed to bump field %s", c.Path)
+			continue
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+	return changes
+}
+
+func (m *Markers) updateField(ctx context.Context, env *Env, field MarkedField) (*Change, error) {
+	con, err := semver.NewConstraint(">=0.0.0")
+	if err != nil {
+		return nil, err
+	}
+	if field.Marker.Filter != "" {
+		con, err = ParseFilter(field.Marker.Filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case field.Marker.Chart != "":
+		i := strings.LastIndex(field.Marker.Chart, "/")
+		if i < 0 {
+			return nil, errors.Errorf("Invalid chart %s, expected <repository>/<name>", field.Marker.Chart)
+		}
+		return BumpChart(ctx, env, m.charts, &ChartReference{
+			Name:        field.Marker.Chart[i+1:],
+			Repository:  field.Marker.Chart[:i],
+			Version:     field.Value,
+			VersionPath: field.Path,
+		}, con)
+	case field.Marker.Image != "":
+		if strings.HasPrefix(field.Value, field.Marker.Image+":") || strings.HasPrefix(field.Value, field.Marker.Image+"@") {
+			mode, err := markerDigest(env, &field.Marker)
+			if err != nil {
+				return nil, err
+			}
+			return BumpImageReference(ctx, env, m.images, field.Value, field.Path, con, mode)
+		}
+		return BumpImage(ctx, env, m.images, &ImageReference{
+			Repository: field.Marker.Image,
+			Tag:        field.Value,
+			TagPath:    field.Path,
+		}, con)
+	default:
+		return nil, errors.New("Marker must specify a chart or an image")
+	}
+}
@@ -0,0 +1,138 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/paulfarver/valet/internal/patch"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// chartsStub serves fixed versions per repository and chart
+type chartsStub map[string][]string
+
+func (s chartsStub) ListVersions(ctx context.Context, repository, chart string) ([]string, error) {
+	versions, ok := s[repository+"/"+chart]
+	if !ok {
+		return nil, fmt.Errorf("unknown chart %s/%s", repository, chart)
+	}
+	return versions, nil
+}
+
+func TestFindMarkers(t *testing.T) {
+	content := "chart:\n" +
+		"  version: 1.2.3 # valet: {\"chart\": \"https://charts.example.com/podinfo\", \"filter\": \"semver:~1.2\"}\n" +
+		"images:\n" +
+		"  - tag: 1.0.0 # valet: {\"image\": \"ghcr.io/example/app\"}\n" +
+		"  - tag: 2.0.0 # pinned\n"
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &node); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FindMarkers(&node)
+	if err != nil {
+		t.Fatalf("FindMarkers() error = %v", err)
+	}
+	want := []MarkedField{
+		{
+			Path:   []string{"chart", "version"},
+			Value:  "1.2.3",
+			Marker: Marker{Chart: "https://charts.example.com/podinfo", Filter: "semver:~1.2"},
+		},
+		{
+			Path:   []string{"images", "0", "tag"},
+			Value:  "1.0.0",
+			Marker: Marker{Image: "ghcr.io/example/app"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindMarkers() = %+v, want %+v", got, want)
+	}
+
+	if err := yaml.Unmarshal([]byte("tag: 1.0.0 # valet: {image}\n"), &node); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FindMarkers(&node); err == nil {
+		t.Error("FindMarkers() of an invalid marker, want error")
+	}
+}
+
+func TestMarkersUpdate(t *testing.T) {
+	charts := chartsStub{
+		"https://charts.example.com/podinfo": {"1.2.3", "1.2.5", "1.3.0"},
+	}
+	images := imagesStub{
+		"ghcr.io/example/app": {"1.0.0", "1.1.0"},
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "chart with filter",
+			content: "version: 1.2.3 # valet: {\"chart\": \"https://charts.example.com/podinfo\", \"filter\": \"semver:~1.2\"}\n",
+			want:    "version: 1.2.5 # valet: {\"chart\": \"https://charts.example.com/podinfo\", \"filter\": \"semver:~1.2\"}\n",
+		},
+		{
+			name:    "quoted image tag",
+			content: "app:\n  tag: \"1.0.0\"   # valet: {\"image\": \"ghcr.io/example/app\"}\n  pullPolicy: Always\n",
+			want:    "app:\n  tag: \"1.1.0\"   # valet: {\"image\": \"ghcr.io/example/app\"}\n  pullPolicy: Always\n",
+		},
+		{
+			name:    "image reference in a sequence",
+			content: "# images\nimages:\n  - ghcr.io/example/app:1.0.0 # valet: {\"image\": \"ghcr.io/example/app\"}\n  - nginx:1.20\n",
+			want:    "# images\nimages:\n  - ghcr.io/example/app:1.1.0 # valet: {\"image\": \"ghcr.io/example/app\"}\n  - nginx:1.20\n",
+		},
+		{
+			name:    "pinned image reference",
+			content: "image: ghcr.io/example/app:1.0.0 # valet: {\"image\": \"ghcr.io/example/app\", \"digest\": \"pin\"}\n",
+			want:    "image: ghcr.io/example/app:1.1.0@sha256:1.1.0 # valet: {\"image\": \"ghcr.io/example/app\", \"digest\": \"pin\"}\n",
+		},
+		{
+			name:    "up to date",
+			content: "version: 1.3.0 # valet: {\"chart\": \"https://charts.example.com/podinfo\"}\n",
+			want:    "version: 1.3.0 # valet: {\"chart\": \"https://charts.example.com/podinfo\"}\n",
+		},
+		{
+			name:    "unmarked",
+			content: "version: 1.2.3 # podinfo\n",
+			want:    "version: 1.2.3 # podinfo\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var node yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.content), &node); err != nil {
+				t.Fatal(err)
+			}
+			env := &Env{Log: logrus.New()}
+			changes, err := NewMarkers(charts, images).Update(context.Background(), env, &node)
+			if err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+
+			edits := []patch.Edit{}
+			for _, change := range changes {
+				edit, err := patch.YAMLPath([]byte(tt.content), &node, change.Path, change.Value)
+				if err != nil {
+					t.Fatalf("YAMLPath() error = %v", err)
+				}
+				edits = append(edits, edit)
+			}
+			got, err := patch.Apply([]byte(tt.content), edits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Update() applied = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
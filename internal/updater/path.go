@@ -0,0 +1,51 @@
+package updater
+
+import (
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/pkg/errors"
+)
+
+// ParsePath splits a path into its segments. Paths starting with a slash are
+// JSON pointers (RFC 6901) such as /spec/chart/version, anything else is a
+// dot separated path such as spec.chart.version.
+func ParsePath(p string) ([]string, error) {
+	if p == "" {
+		return nil, errors.New("Empty path")
+	}
+	if strings.HasPrefix(p, "/") {
+		return gabs.JSONPointerToSlice(p)
+	}
+	return gabs.DotPathToSlice(p), nil
+}
+
+// FieldConfig opts a single field into updates from the rule config, for
+// files where neither annotations nor marker comments can be used, e.g. JSON
+//
+//	fields:
+//	  - path: /deploy/chart/version
+//	    chart: https://charts.example.com/podinfo
+//	  - path: /deploy/image
+//	    image: ghcr.io/example/app
+//	    filter: semver:~1.2
+type FieldConfig struct {
+	Path   string `yaml:"path"`
+	Chart  string `yaml:"chart"`
+	Image  string `yaml:"image"`
+	Filter string `yaml:"filter"`
+	Digest string `yaml:"digest"`
+}
+
+func (c FieldConfig) Validate() error {
+	if _, err := ParsePath(c.Path); err != nil {
+		return errors.Wrapf(err, "Invalid field path %s", c.Path)
+	}
+	if c.Chart == "" && c.Image == "" {
+		return errors.Errorf("Field %s must specify a chart or an image", c.Path)
+	}
+	if _, err := ParseDigestMode(c.Digest); err != nil {
+		return errors.Wrapf(err, "Invalid digest mode of field %s", c.Path)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package updater
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/pkg/errors"
+)
+
+var ErrSourceNotFound = errors.New("Source not found")
+
+// sourceKinds are the Flux source kinds that can serve helm charts
+var sourceKinds = map[string]bool{
+	"HelmRepository": true,
+	"OCIRepository":  true,
+}
+
+// SourceIndex maps Flux source objects found in a repository to their URLs
+type SourceIndex map[string]string
+
+func sourceKey(kind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+// IndexSources collects every HelmRepository and OCIRepository among the documents
+func IndexSources(docs []*gabs.Container) SourceIndex {
+	index := SourceIndex{}
+	for _, doc := range docs {
+		for _, item := range Items(doc) {
+			index.Add(item.Doc)
+		}
+	}
+	return index
+}
+
+// Add indexes the document if it is a Flux source with a URL
+func (s SourceIndex) Add(doc *gabs.Container) {
+	apiVersion, _ := doc.Search("apiVersion").Data().(string)
+	if !strings.HasPrefix(apiVersion, "source.toolkit.fluxcd.io/") {
+		return
+	}
+	kind, _ := doc.Search("kind").Data().(string)
+	if !sourceKinds[kind] {
+		return
+	}
+	name, _ := doc.Search("metadata", "name").Data().(string)
+	namespace, _ := doc.Search("metadata", "namespace").Data().(string)
+	url, ok := doc.Search("spec", "url").Data().(string)
+	if !ok || name == "" {
+		return
+	}
+
+	s[sourceKey(kind, namespace, name)] = url
+}
+
+// Resolve returns the URL of the referenced source. An empty kind is treated
+// as HelmRepository, which is the default in Flux.
+func (s SourceIndex) Resolve(kind, namespace, name string) (string, error) {
+	if kind == "" {
+		kind = "HelmRepository"
+	}
+	url, ok := s[sourceKey(kind, namespace, name)]
+	if !ok {
+		return "", errors.Wrapf(ErrSourceNotFound, "%s %s/%s", kind, namespace, name)
+	}
+	return url, nil
+}
@@ -0,0 +1,207 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/paulfarver/valet/internal/chart"
+	"github.com/paulfarver/valet/internal/image"
+	"github.com/paulfarver/valet/internal/patch"
+	"github.com/pkg/errors"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type terraform struct {
+	charts chart.Service
+	images image.Service
+}
+
+// NewTerraform bumps the chart versions of helm_release resources and the
+// images of kubernetes_* resources in Terraform files. Only attributes set to
+// literal strings are updated, and only the string itself is rewritten. A
+// marker comment on the line before an attribute sets its filter:
+//
+//	resource "helm_release" "podinfo" {
+//	  repository = "https://stefanprodan.github.io/podinfo"
+//	  chart      = "podinfo"
+//	  # valet: {"filter": "semver:~6.0"}
+//	  version    = "6.0.3"
+//	}
+func NewTerraform(charts chart.Service, images image.Service) FileUpdater {
+	return &terraform{
+		charts: charts,
+		images: images,
+	}
+}
+
+func (t *terraform) UpdateFile(ctx context.Context, env *Env, content []byte) ([]Change, error) {
+	file, diags := hclsyntax.ParseConfig(content, "", hcl.Pos{Line: 1, Column: 1, Byte: 0})
+	if diags.HasErrors() {
+		return nil, errors.Wrap(diags, "Failed to parse hcl")
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, errors.New("Unexpected hcl body")
+	}
+
+	changes := []Change{}
+	for _, block := range body.Blocks {
+		if block.Type != "resource" || len(block.Labels) != 2 {
+			continue
+		}
+		resource := strings.Join(block.Labels, ".")
+
+		var cs []Change
+		var err error
+		switch {
+		case block.Labels[0] == "helm_release":
+			cs, err = t.updateRelease(ctx, env, content, block.Body)
+		case strings.HasPrefix(block.Labels[0], "kubernetes_"):
+			cs, err = t.updateImages(ctx, env, content, block.Body)
+		}
+		if err != nil {
+			env.Log.WithError(err).Warnf("Failed to bump %s", resource)
+			continue
+		}
+		changes = append(changes, cs...)
+	}
+
+	return changes, nil
+}
+
+func (t *terraform) updateRelease(ctx context.Context, env *Env, content []byte, body *hclsyntax.Body) ([]Change, error) {
+	name, _, ok := literalAttribute(content, body, "chart")
+	if !ok {
+		return nil, errors.New("Chart is not a literal string")
+	}
+	repo, _, ok := literalAttribute(content, body, "repository")
+	if !ok {
+		// Charts can be given as a full URL without a repository
+		i := strings.LastIndex(name, "/")
+		if i < 0 || !strings.Contains(name, "://") {
+			return nil, errors.New("Repository is not a literal string")
+		}
+		repo, name = name[:i], name[i+1:]
+	}
+	version, rng, ok := literalAttribute(content, body, "version")
+	if !ok {
+		return nil, errors.New("Version is not a literal string")
+	}
+
+	con, err := markerFilter(lineMarker(content, rng.Start.Line))
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := BumpChart(ctx, env, t.charts, &ChartReference{
+		Name:       name,
+		Repository: repo,
+		Version:    version,
+	}, con)
+	if err != nil || change == nil {
+		return nil, err
+	}
+	change.Edit = literalEdit(rng, change.Value)
+
+	return []Change{*change}, nil
+}
+
+// updateImages bumps every literal image attribute nested in the body, as
+// found in the container blocks of kubernetes_* resources
+func (t *terraform) updateImages(ctx context.Context, env *Env, content []byte, body *hclsyntax.Body) ([]Change, error) {
+	changes := []Change{}
+
+	if str, rng, ok := literalAttribute(content, body, "image"); ok {
+		marker := lineMarker(content, rng.Start.Line)
+		con, err := markerFilter(marker)
+		if err != nil {
+			return nil, err
+		}
+		mode, err := markerDigest(env, marker)
+		if err != nil {
+			return nil, err
+		}
+		change, err := BumpImageReference(ctx, env, t.images, str, nil, con, mode)
+		if err != nil {
+			env.Log.WithError(err).Warnf("Failed to bump image %s", str)
+		} else if change != nil {
+			change.Edit = literalEdit(rng, change.Value)
+			changes = append(changes, *change)
+		}
+	}
+
+	for _, block := range body.Blocks {
+		cs, err := t.updateImages(ctx, env, content, block.Body)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, cs...)
+	}
+
+	return changes, nil
+}
+
+// literalAttribute returns the value of an attribute set to a plain quoted
+// string, along with the range of the string inside the quotes
+func literalAttribute(content []byte, body *hclsyntax.Body, name string) (string, hcl.Range, bool) {
+	attr, ok := body.Attributes[name]
+	if !ok {
+		return "", hcl.Range{}, false
+	}
+	tmpl, ok := attr.Expr.(*hclsyntax.TemplateExpr)
+	if !ok || len(tmpl.Parts) != 1 {
+		return "", hcl.Range{}, false
+	}
+	lit, ok := tmpl.Parts[0].(*hclsyntax.LiteralValueExpr)
+	if !ok || !lit.Val.Type().Equals(cty.String) {
+		return "", hcl.Range{}, false
+	}
+	value := lit.Val.AsString()
+
+	// Make sure the source is the plain string, without escapes to preserve
+	rng := tmpl.SrcRange
+	if rng.End.Byte-rng.Start.Byte != len(value)+2 || string(content[rng.Start.Byte+1:rng.End.Byte-1]) != value {
+		return "", hcl.Range{}, false
+	}
+	rng.Start.Byte++
+	rng.Start.Column++
+	rng.End.Byte--
+	rng.End.Column--
+
+	return value, rng, true
+}
+
+func literalEdit(rng hcl.Range, value string) *patch.Edit {
+	return &patch.Edit{
+		Offset: rng.Start.Byte,
+		Length: rng.End.Byte - rng.Start.Byte,
+		Text:   value,
+	}
+}
+
+// lineMarker returns the marker in a comment on the line before the given
+// 1-based line, if there is one
+func lineMarker(content []byte, line int) *Marker {
+	lines := strings.Split(string(content), "\n")
+	if line < 2 || line-2 >= len(lines) {
+		return nil
+	}
+	comment := strings.TrimSpace(lines[line-2])
+	for _, prefix := range []string{"#", "//"} {
+		if strings.HasPrefix(comment, prefix) {
+			comment = strings.TrimSpace(strings.TrimPrefix(comment, prefix))
+			break
+		}
+	}
+	if !strings.HasPrefix(comment, markerPrefix) {
+		return nil
+	}
+	var m Marker
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(comment, markerPrefix)), &m); err != nil {
+		return nil
+	}
+	return &m
+}
@@ -0,0 +1,152 @@
+package updater
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/paulfarver/valet/internal/patch"
+)
+
+func TestLiteralAttribute(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantValue string
+		wantOk    bool
+		want      string
+	}{
+		{
+			name:      "string",
+			content:   "version = \"1.2.3\"\n",
+			wantValue: "1.2.3",
+			wantOk:    true,
+			want:      "version = \"2.0.0\"\n",
+		},
+		{
+			name:      "multi-byte characters before the string",
+			content:   "description = \"æøå\"\nversion     = \"1.2.3\" # æøå\n",
+			wantValue: "1.2.3",
+			wantOk:    true,
+			want:      "description = \"æøå\"\nversion     = \"2.0.0\" # æøå\n",
+		},
+		{
+			name:      "empty string",
+			content:   "version = \"\"\n",
+			wantValue: "",
+			wantOk:    true,
+			want:      "version = \"2.0.0\"\n",
+		},
+		{
+			name:    "escapes",
+			content: "version = \"1.2.\\u0033\"\n",
+		},
+		{
+			name:    "interpolation",
+			content: "version = \"${var.version}\"\n",
+		},
+		{
+			name:    "template with literal text",
+			content: "version = \"v${var.version}\"\n",
+		},
+		{
+			name:    "reference",
+			content: "version = var.version\n",
+		},
+		{
+			name:    "number",
+			content: "version = 1\n",
+		},
+		{
+			name:    "heredoc",
+			content: "version = <<EOT\n1.2.3\nEOT\n",
+		},
+		{
+			name:    "missing",
+			content: "chart = \"nginx\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, diags := hclsyntax.ParseConfig([]byte(tt.content), "", hcl.Pos{Line: 1, Column: 1, Byte: 0})
+			if diags.HasErrors() {
+				t.Fatal(diags)
+			}
+			body := file.Body.(*hclsyntax.Body)
+
+			value, rng, ok := literalAttribute([]byte(tt.content), body, "version")
+			if value != tt.wantValue || ok != tt.wantOk {
+				t.Fatalf("literalAttribute() = %q, %v, want %q, %v", value, ok, tt.wantValue, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			if source := tt.content[rng.Start.Byte:rng.End.Byte]; source != value {
+				t.Errorf("range %v reads %q, want %q", rng, source, value)
+			}
+			if rng.End.Column-rng.Start.Column != len([]rune(value)) {
+				t.Errorf("range %v spans %d columns, want %d", rng, rng.End.Column-rng.Start.Column, len([]rune(value)))
+			}
+
+			got, err := patch.Apply([]byte(tt.content), []patch.Edit{*literalEdit(rng, "2.0.0")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("literalEdit() applied = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineMarker(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    int
+		want    *Marker
+	}{
+		{
+			name:    "hash comment",
+			content: "# valet: {\"filter\": \"semver:~1.2\"}\nversion = \"1.2.3\"\n",
+			line:    2,
+			want:    &Marker{Filter: "semver:~1.2"},
+		},
+		{
+			name:    "slash comment",
+			content: "  // valet: {\"image\": \"nginx\"}\n  image = \"1.21\"\n",
+			line:    2,
+			want:    &Marker{Image: "nginx"},
+		},
+		{
+			name:    "other comment",
+			content: "# pinned\nversion = \"1.2.3\"\n",
+			line:    2,
+		},
+		{
+			name:    "invalid marker",
+			content: "# valet: {filter}\nversion = \"1.2.3\"\n",
+			line:    2,
+		},
+		{
+			name:    "first line",
+			content: "version = \"1.2.3\"\n",
+			line:    1,
+		},
+		{
+			name:    "out of range",
+			content: "version = \"1.2.3\"\n",
+			line:    5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lineMarker([]byte(tt.content), tt.line); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lineMarker() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
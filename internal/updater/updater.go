@@ -0,0 +1,154 @@
+package updater
+
+import (
+	"context"
+	"path"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/paulfarver/valet/internal/chart"
+	"github.com/paulfarver/valet/internal/image"
+	"github.com/paulfarver/valet/internal/patch"
+	"github.com/sirupsen/logrus"
+)
+
+// Change is a single field of a document that should be set to a new value.
+// Old and New are the versions of the bumped chart or image, while Value is
+// what the field is set to, e.g. a full image reference embedding the tag.
+// Updaters of files that are not YAML locate the change in the content
+// themselves and set Edit instead of Path.
+type Change struct {
+	Path  []string
+	Kind  string
+	Name  string
+	Old   string
+	New   string
+	Value string
+	Edit  *patch.Edit
+}
+
+// Kinds of the dependency bumped by a change
+const (
+	KindChart = "chart"
+	KindImage = "image"
+)
+
+// Env is the state shared by all documents scanned by a rule. Digest is the
+// digest mode of the rule, used unless a document or marker overrides it.
+type Env struct {
+	Log     logrus.FieldLogger
+	Sources SourceIndex
+	Digest  DigestMode
+}
+
+// Updater finds the changes required to bring a document up to date. An
+// updater must not modify the document, the caller applies the changes.
+type Updater interface {
+	Update(ctx context.Context, env *Env, doc *gabs.Container) ([]Change, error)
+}
+
+// FileUpdater finds the changes required to bring a whole file up to date,
+// for file formats that are not made of YAML documents
+type FileUpdater interface {
+	UpdateFile(ctx context.Context, env *Env, content []byte) ([]Change, error)
+}
+
+// appendPath returns a copy of the path extended with the segments
+func appendPath(path []string, segments ...string) []string {
+	return append(append([]string{}, path...), segments...)
+}
+
+type registration struct {
+	apiVersion string
+	kind       string
+	updater    Updater
+}
+
+// Registry selects updaters by the apiVersion and kind of a document, or by
+// name for updaters that rules opt into explicitly
+type Registry struct {
+	registrations []registration
+	named         map[string]Updater
+	formats       map[string]FileUpdater
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		named:   map[string]Updater{},
+		formats: map[string]FileUpdater{},
+	}
+}
+
+// RegisterFormat adds the updater for files of a format other than YAML
+func (r *Registry) RegisterFormat(format string, u FileUpdater) {
+	r.formats[format] = u
+}
+
+// Format returns the updater for files of the format, or false if there is none
+func (r *Registry) Format(format string) (FileUpdater, bool) {
+	u, ok := r.formats[format]
+	return u, ok
+}
+
+// RegisterNamed adds an updater that rules can select by name. Named updaters
+// apply to every document matched by the rule, regardless of its kind.
+func (r *Registry) RegisterNamed(name string, u Updater) {
+	r.named[name] = u
+}
+
+// Named returns the updater registered under the name, or false if there is none
+func (r *Registry) Named(name string) (Updater, bool) {
+	u, ok := r.named[name]
+	return u, ok
+}
+
+// Register adds an updater for documents of the given kind. The apiVersion is
+// a path.Match pattern, so "helm.toolkit.fluxcd.io/*" matches every version of
+// the group. Updaters registered later take precedence over earlier ones.
+func (r *Registry) Register(apiVersion, kind string, u Updater) {
+	r.registrations = append(r.registrations, registration{
+		apiVersion: apiVersion,
+		kind:       kind,
+		updater:    u,
+	})
+}
+
+// Lookup returns the updater for the document, or false if there is none
+func (r *Registry) Lookup(doc *gabs.Container) (Updater, bool) {
+	apiVersion, _ := doc.Search("apiVersion").Data().(string)
+	kind, _ := doc.Search("kind").Data().(string)
+
+	for i := len(r.registrations) - 1; i >= 0; i-- {
+		reg := r.registrations[i]
+		if reg.kind != kind {
+			continue
+		}
+		if ok, _ := path.Match(reg.apiVersion, apiVersion); ok {
+			return reg.updater, true
+		}
+	}
+	return nil, false
+}
+
+// NewDefaultRegistry returns a registry with the updaters for every resource
+// kind valet supports out of the box
+func NewDefaultRegistry(charts chart.Service, images image.Service) *Registry {
+	r := NewRegistry()
+	r.Register("flux.weave.works/*", "HelmRelease", NewHelmReleaseV1(charts, images))
+	r.Register("helm.fluxcd.io/*", "HelmRelease", NewHelmReleaseV1(charts, images))
+	r.Register("helm.toolkit.fluxcd.io/*", "HelmRelease", NewHelmReleaseV2(charts, images))
+	r.Register("argoproj.io/*", "Application", NewArgoApplication(charts))
+	r.Register("argoproj.io/*", "ApplicationSet", NewArgoApplicationSet(charts))
+	for _, kind := range []string{"Deployment", "StatefulSet", "DaemonSet", "ReplicaSet"} {
+		r.Register("apps/*", kind, NewWorkload(images, "spec", "template", "spec"))
+	}
+	r.Register("batch/*", "Job", NewWorkload(images, "spec", "template", "spec"))
+	r.Register("batch/*", "CronJob", NewWorkload(images, "spec", "jobTemplate", "spec", "template", "spec"))
+	r.Register("v1", "Pod", NewWorkload(images, "spec"))
+	r.RegisterNamed("kustomize", NewKustomize(charts, images))
+	r.RegisterNamed("helm-chart", NewHelmChart(charts))
+	r.RegisterNamed("helm-values", NewValuesFile(images))
+	r.RegisterNamed("compose", NewCompose(images))
+	r.RegisterFormat(FormatDockerfile, NewDockerfile(images))
+	r.RegisterFormat(FormatHCL, NewTerraform(charts, images))
+	return r
+}
@@ -0,0 +1,141 @@
+package updater
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/Masterminds/semver/v3"
+	"github.com/paulfarver/valet/internal/image"
+	"github.com/pkg/errors"
+)
+
+// valuesImagesAnnotation enables image detection in the values of a release
+const valuesImagesAnnotation = "valet.io/values-images"
+
+// ValuesImages detects images in helm values following the common chart
+// conventions, where a key named image or ending in Image holds either a full
+// image reference, or a block with a repository, an optional registry and a tag:
+//
+//	image: ghcr.io/example/app:1.2.3
+//	controller:
+//	  image:
+//	    registry: ghcr.io
+//	    repository: example/controller
+//	    tag: 1.2.3
+type ValuesImages struct {
+	images image.Service
+}
+
+func NewValuesImages(images image.Service) *ValuesImages {
+	return &ValuesImages{
+		images: images,
+	}
+}
+
+// Bump returns the changes bumping every image found in the values at the
+// path. The filter is called with the dotted path of each image within the
+// values, e.g. controller.image, to get its constraint. Full image references
+// have their digest handled according to the mode.
+func (v *ValuesImages) Bump(ctx context.Context, env *Env, doc *gabs.Container, path []string, mode DigestMode, filter func(name string) (*semver.Constraints, error)) []Change {
+	changes := []Change{}
+	v.walk(ctx, env, doc.Search(path...), path, len(path), mode, filter, &changes)
+	return changes
+}
+
+func (v *ValuesImages) walk(ctx context.Context, env *Env, node *gabs.Container, path []string, root int, mode DigestMode, filter func(name string) (*semver.Constraints, error), changes *[]Change) {
+	if node == nil {
+		return
+	}
+
+	if arr, ok := node.Data().([]interface{}); ok {
+		for i := range arr {
+			v.walk(ctx, env, node.Index(i), appendPath(path, strconv.Itoa(i)), root, mode, filter, changes)
+		}
+		return
+	}
+
+	children := node.ChildrenMap()
+	keys := make([]string, 0, len(children))
+	for key := range children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		child := children[key]
+		p := appendPath(path, key)
+		if key != "image" && !strings.HasSuffix(key, "Image") {
+			v.walk(ctx, env, child, p, root, mode, filter, changes)
+			continue
+		}
+
+		name := strings.Join(p[root:], ".")
+		change, err := v.bump(ctx, env, child, p, name, mode, filter)
+		if err != nil {
+			env.Log.WithError(err).Warnf("Failed to bump image at %s", name)
+			continue
+		}
+		if change != nil {
+			*changes = append(*changes, *change)
+		}
+	}
+}
+
+func (v *ValuesImages) bump(ctx context.Context, env *Env, node *gabs.Container, path []string, name string, mode DigestMode, filter func(name string) (*semver.Constraints, error)) (*Change, error) {
+	if str, ok := node.Data().(string); ok {
+		con, err := filter(name)
+		if err != nil {
+			return nil, err
+		}
+		return BumpImageReference(ctx, env, v.images, str, path, con, mode)
+	}
+
+	repository, ok := node.Search("repository").Data().(string)
+	if !ok {
+		return nil, nil
+	}
+	tag, ok := node.Search("tag").Data().(string)
+	if !ok || tag == "" {
+		// Charts commonly default an empty tag to their appVersion
+		return nil, nil
+	}
+	if registry, ok := node.Search("registry").Data().(string); ok && registry != "" {
+		repository = registry + "/" + repository
+	}
+
+	con, err := filter(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return BumpImage(ctx, env, v.images, &ImageReference{
+		Repository: repository,
+		Tag:        tag,
+		TagPath:    appendPath(path, "tag"),
+	}, con)
+}
+
+type valuesFile struct {
+	values *ValuesImages
+}
+
+// NewValuesFile bumps the images of a standalone helm values file. Values
+// files carry no annotations, so this updater is opted into by naming it in a
+// rule, and filters are set with marker comments instead.
+func NewValuesFile(images image.Service) Updater {
+	return &valuesFile{
+		values: NewValuesImages(images),
+	}
+}
+
+func (u *valuesFile) Update(ctx context.Context, env *Env, doc *gabs.Container) ([]Change, error) {
+	if _, ok := doc.Data().(map[string]interface{}); !ok {
+		return nil, errors.New("Values must be a map")
+	}
+	return u.values.Bump(ctx, env, doc, []string{}, env.Digest, func(name string) (*semver.Constraints, error) {
+		return semver.NewConstraint(">=0.0.0")
+	}), nil
+}
@@ -0,0 +1,107 @@
+package updater
+
+import (
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const filterAnnotationPrefix = "filter.valet.io/"
+
+// ParseFilter parses a filter of the form "<type>:<expression>" into a
+// version constraint. Only the semver filter type is supported.
+func ParseFilter(filter string) (*semver.Constraints, error) {
+	vals := strings.SplitN(filter, ":", 2)
+	if len(vals) != 2 {
+		return nil, errors.Errorf("Invalid filter %s", filter)
+	}
+
+	switch vals[0] {
+	case "semver":
+		con, err := semver.NewConstraint(vals[1])
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to parse constraint")
+		}
+		return con, nil
+	default:
+		return nil, errors.Errorf("Unknown filter type %s", vals[0])
+	}
+}
+
+// AnnotationFilter returns the constraint set by the filter.valet.io/<name>
+// annotation of the document. Documents without the annotation accept any
+// version.
+func AnnotationFilter(doc *gabs.Container, name string) (*semver.Constraints, error) {
+	value := doc.Search("metadata", "annotations", filterAnnotationPrefix+name)
+	if value == nil {
+		return semver.NewConstraint(">=0.0.0")
+	}
+
+	str, ok := value.Data().(string)
+	if !ok {
+		return nil, errors.New("Invalid filter type")
+	}
+
+	return ParseFilter(str)
+}
+
+// LatestVersion returns the highest of the available versions that is greater
+// than current and satisfies the constraint, or current if there is none. The
+// returned version keeps the original string it was parsed from, so callers
+// should write back v.Original() to preserve prefixes, build metadata and
+// padding exactly as published upstream. This applies to chart versions and
+// image tags alike.
+func LatestVersion(log logrus.FieldLogger, current *semver.Version, available []string, con *semver.Constraints) *semver.Version {
+	v := current
+	for _, version := range available {
+		v2, err := semver.NewVersion(version)
+		if err != nil {
+			log.WithError(err).Debugf("Failed to parse version %s", version)
+			continue
+		}
+		if v2.GreaterThan(v) && con.Check(v2) {
+			v = v2
+		}
+	}
+	return v
+}
+
+// Update types of a change, by the most significant part of the version that changed
+const (
+	UpdateMajor  = "major"
+	UpdateMinor  = "minor"
+	UpdatePatch  = "patch"
+	UpdateDigest = "digest"
+)
+
+// UpdateType returns the update type of the change, or the empty string if
+// the versions cannot be compared. Changes that keep the tag of an image
+// and only move its digest, or that set a digest field, are digest updates.
+func UpdateType(change Change) string {
+	oldTag := strings.SplitN(change.Old, "@", 2)[0]
+	newTag := strings.SplitN(change.New, "@", 2)[0]
+	if oldTag == newTag || (strings.Contains(oldTag, ":") && strings.Contains(newTag, ":")) {
+		return UpdateDigest
+	}
+
+	oldV, err := semver.NewVersion(oldTag)
+	if err != nil {
+		return ""
+	}
+	newV, err := semver.NewVersion(newTag)
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case oldV.Major() != newV.Major():
+		return UpdateMajor
+	case oldV.Minor() != newV.Minor():
+		return UpdateMinor
+	default:
+		return UpdatePatch
+	}
+}
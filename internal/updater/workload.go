@@ -0,0 +1,75 @@
+package updater
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/paulfarver/valet/internal/image"
+	"github.com/pkg/errors"
+)
+
+// containerLists are the fields of a pod spec that hold containers
+var containerLists = []string{"containers", "initContainers", "ephemeralContainers"}
+
+type workload struct {
+	images  image.Service
+	podSpec []string
+}
+
+// NewWorkload bumps the image tags of the containers in the pod spec found at
+// the given path. Filters are keyed by container name, so the tags of the
+// container "app" are constrained by the filter.valet.io/app annotation.
+func NewWorkload(images image.Service, podSpec ...string) Updater {
+	return &workload{
+		images:  images,
+		podSpec: podSpec,
+	}
+}
+
+func (w *workload) Update(ctx context.Context, env *Env, doc *gabs.Container) ([]Change, error) {
+	if !doc.Exists(w.podSpec...) {
+		return nil, errors.New("Failed to get pod spec")
+	}
+
+	changes := []Change{}
+	for _, list := range containerLists {
+		path := appendPath(w.podSpec, list)
+		for i, container := range doc.Search(path...).Children() {
+			name, _ := container.Search("name").Data().(string)
+			change, err := w.updateContainer(ctx, env, doc, container, appendPath(path, strconv.Itoa(i), "image"))
+			if err != nil {
+				env.Log.WithError(err).Warnf("Failed to bump image of container %s", name)
+				continue
+			}
+			if change != nil {
+				changes = append(changes, *change)
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+func (w *workload) updateContainer(ctx context.Context, env *Env, doc, container *gabs.Container, path []string) (*Change, error) {
+	name, ok := container.Search("name").Data().(string)
+	if !ok {
+		return nil, errors.New("Failed to get container name")
+	}
+	str, ok := container.Search("image").Data().(string)
+	if !ok {
+		return nil, errors.New("Failed to get container image")
+	}
+
+	con, err := AnnotationFilter(doc, name)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := AnnotationDigest(env, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return BumpImageReference(ctx, env, w.images, str, path, con, mode)
+}